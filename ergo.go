@@ -91,6 +91,7 @@ func main() {
 Usage:
 	ergo initdb [--conf <filename>] [--quiet]
 	ergo upgradedb [--conf <filename>] [--quiet]
+	ergo dbversion [--conf <filename>] [--quiet]
 	ergo importdb <database.json> [--conf <filename>] [--quiet]
 	ergo genpasswd [--conf <filename>] [--quiet]
 	ergo mkcerts [--conf <filename>] [--quiet]
@@ -168,6 +169,16 @@ Options:
 		if !arguments["--quiet"].(bool) {
 			log.Println("database upgraded: ", config.Datastore.Path)
 		}
+	} else if arguments["dbversion"].(bool) {
+		version, latest, err := irc.SchemaVersion(config)
+		if err != nil {
+			log.Fatal("Error while reading db schema version:", err.Error())
+		}
+		fmt.Printf("database schema version: %d\n", version)
+		fmt.Printf("latest schema version:   %d\n", latest)
+		if version != latest {
+			fmt.Println("run `ergo upgradedb` (or enable datastore.autoupgrade) to upgrade")
+		}
 	} else if arguments["importdb"].(bool) {
 		err = irc.ImportDB(config, arguments["<database.json>"].(string))
 		if err != nil {
@@ -189,7 +200,7 @@ Options:
 			os.Exit(1)
 		}
 		if !arguments["--smoke"].(bool) {
-			server.Run()
+			runServer(server)
 		}
 	}
 }
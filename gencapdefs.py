@@ -171,6 +171,12 @@ CAPDEFS = [
         url="https://ergo.chat/nope",
         standard="Ergo vendor",
     ),
+    CapDef(
+        identifier="IdleNotify",
+        name="ergo.chat/idle-notify",
+        url="https://github.com/ergochat/ergo/blob/master/docs/MANUAL.md#idle-notifications",
+        standard="Ergo vendor",
+    ),
     CapDef(
         identifier="Multiline",
         name="draft/multiline",
@@ -24,6 +24,7 @@ import (
 	"github.com/ergochat/ergo/irc/migrations"
 	"github.com/ergochat/ergo/irc/modes"
 	"github.com/ergochat/ergo/irc/passwd"
+	"github.com/ergochat/ergo/irc/sno"
 	"github.com/ergochat/ergo/irc/utils"
 )
 
@@ -46,11 +47,16 @@ const (
 	keyAccountSuspended        = "account.suspended %s" // client realname stored as string
 	keyAccountPwReset          = "account.pwreset %s"
 	keyAccountEmailChange      = "account.emailchange %s"
+	keyAccountTOTP             = "account.totp %s"
 	// for an always-on client, a map of channel names they're in to their current modes
 	// (not to be confused with their amodes, which a non-always-on client can have):
 	keyAccountChannelToModes = "account.channeltomodes %s"
 
 	maxCertfpsPerAccount = 5
+
+	// minimum interval between exports of the same account's data, or between
+	// requests by the account holder for an export or erasure
+	accountRequestInterval = 10 * time.Minute
 )
 
 // everything about accounts is persistent; therefore, the database is the authoritative
@@ -66,6 +72,9 @@ type AccountManager struct {
 	skeletonToAccount map[string]string
 	accountToMethod   map[string]NickEnforcementMethod
 	registerThrottle  connection_limits.GenericThrottle
+	// time of the last NS EXPORT of each account, and of the last request
+	// by its holder for an export or erasure
+	requestTimes map[accountRequest]time.Time
 }
 
 func (am *AccountManager) Initialize(server *Server) {
@@ -73,6 +82,7 @@ func (am *AccountManager) Initialize(server *Server) {
 	am.nickToAccount = make(map[string]string)
 	am.skeletonToAccount = make(map[string]string)
 	am.accountToMethod = make(map[string]NickEnforcementMethod)
+	am.requestTimes = make(map[accountRequest]time.Time)
 	am.server = server
 
 	config := server.Config()
@@ -592,7 +602,7 @@ type alwaysOnChannelStatus struct {
 	JoinTime int64
 }
 
-func (am *AccountManager) saveChannels(account string, channelToModes map[string]alwaysOnChannelStatus) {
+func (am *AccountManager) saveChannels(account string, channelToModes map[string]alwaysOnChannelStatus) (err error) {
 	j, err := json.Marshal(channelToModes)
 	if err != nil {
 		am.server.logger.Error("internal", "couldn't marshal channel-to-modes", account, err.Error())
@@ -600,9 +610,9 @@ func (am *AccountManager) saveChannels(account string, channelToModes map[string
 	}
 	jStr := string(j)
 	key := fmt.Sprintf(keyAccountChannelToModes, account)
-	am.server.store.Update(func(tx *buntdb.Tx) error {
-		tx.Set(key, jStr, nil)
-		return nil
+	return am.server.store.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(key, jStr, nil)
+		return err
 	})
 }
 
@@ -624,12 +634,12 @@ func (am *AccountManager) loadChannels(account string) (channelToModes map[strin
 	return
 }
 
-func (am *AccountManager) saveModes(account string, uModes modes.Modes) {
+func (am *AccountManager) saveModes(account string, uModes modes.Modes) (err error) {
 	modeStr := uModes.String()
 	key := fmt.Sprintf(keyAccountModes, account)
-	am.server.store.Update(func(tx *buntdb.Tx) error {
-		tx.Set(key, modeStr, nil)
-		return nil
+	return am.server.store.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(key, modeStr, nil)
+		return err
 	})
 }
 
@@ -692,15 +702,18 @@ func (am *AccountManager) loadTimeMap(baseKey, account string) (lastSeen map[str
 	return
 }
 
-func (am *AccountManager) saveRealname(account string, realname string) {
+func (am *AccountManager) saveRealname(account string, realname string) (err error) {
 	key := fmt.Sprintf(keyAccountRealname, account)
-	am.server.store.Update(func(tx *buntdb.Tx) error {
+	return am.server.store.Update(func(tx *buntdb.Tx) error {
 		if realname != "" {
-			tx.Set(key, realname, nil)
-		} else {
-			tx.Delete(key)
+			_, _, err := tx.Set(key, realname, nil)
+			return err
 		}
-		return nil
+		_, err := tx.Delete(key)
+		if err == buntdb.ErrNotFound {
+			err = nil
+		}
+		return err
 	})
 }
 
@@ -1399,11 +1412,29 @@ func (am *AccountManager) AuthenticateByPassphrase(client *Client, accountName s
 		return &ThrottleError{remainingTime}
 	}
 
+	if am.requiresTLS(client, accountName) {
+		return errAccountRequiresTLS
+	}
+
+	ipKey, accountKey := am.server.lockoutKeyIP(client.IP()), lockoutKeyAccount(accountName)
+	if remainingTime := am.server.checkLoginLockout(ipKey); remainingTime != 0 {
+		return &ThrottleError{remainingTime}
+	}
+	am.server.throttleLogin(accountKey)
+
 	var account ClientAccount
 
 	defer func() {
-		if err == nil {
+		// the auth script may have substituted a different account name
+		if err == nil && am.requiresTLS(client, account.NameCasefolded) {
+			err = errAccountRequiresTLS
+		}
+		switch err {
+		case nil:
+			am.server.loginSucceeded(accountKey)
 			am.Login(client, account)
+		case errAccountInvalidCredentials, errAccountDoesNotExist:
+			am.server.loginFailed(client, sno.LocalAccounts, ipKey, accountKey)
 		}
 	}()
 
@@ -1419,14 +1450,74 @@ func (am *AccountManager) AuthenticateByPassphrase(client *Client, accountName s
 				accountName = output.AccountName
 			}
 			account, err = am.loadWithAutocreation(accountName, config.Accounts.AuthScript.Autocreate)
+			if err == nil && am.twoFactorEnrolled(config, account.NameCasefolded) {
+				// the script vouched for the passphrase, but not for the code
+				_, code := splitTwoFactorCode(passphrase)
+				err = am.checkTwoFactorCode(account.NameCasefolded, code)
+			}
 			return
 		}
 	}
 
-	account, err = am.checkPassphrase(accountName, passphrase)
+	// for accounts enrolled in two-factor authentication, the code is appended
+	// to the passphrase, separated by a colon, e.g., "hunter2:123456"
+	enrolled := am.twoFactorEnrolled(config, accountName)
+	password, code := passphrase, ""
+	if enrolled {
+		password, code = splitTwoFactorCode(passphrase)
+	}
+	account, err = am.checkPassphrase(accountName, password)
+	if err == nil && enrolled {
+		err = am.checkTwoFactorCode(account.NameCasefolded, code)
+	}
 	return err
 }
 
+// requiresTLS returns whether accounts.require-tls forbids the client
+// from logging into the account, because it isn't connected over TLS
+func (am *AccountManager) requiresTLS(client *Client, accountName string) bool {
+	matcher := am.server.Config().Accounts.RequireTLS.accountMatcher
+	if matcher == nil || client.HasMode(modes.TLS) {
+		return false
+	}
+	cfname, err := CasefoldName(accountName)
+	if err != nil {
+		return false
+	}
+	return matcher.MatchString(cfname)
+}
+
+// twoFactorEnrolled returns whether logging into the account requires a TOTP code
+func (am *AccountManager) twoFactorEnrolled(config *Config, accountName string) bool {
+	if !config.Accounts.TOTP.Enabled {
+		return false
+	}
+	cfname, err := CasefoldName(accountName)
+	if err != nil {
+		return false
+	}
+	return am.server.TwoFactorEnabled(fmt.Sprintf(keyAccountTOTP, cfname))
+}
+
+// splitTwoFactorCode separates a TOTP code from the passphrase it was appended to;
+// if there's no code, the entire string is the passphrase.
+func splitTwoFactorCode(passphrase string) (password, code string) {
+	if colonIndex := strings.LastIndexByte(passphrase, ':'); colonIndex != -1 {
+		return passphrase[:colonIndex], passphrase[colonIndex+1:]
+	}
+	return passphrase, ""
+}
+
+// checkTwoFactorCode validates a TOTP code for an enrolled account. A missing or
+// invalid code is reported the same way as a wrong password, so that a client
+// without the code can't learn whether the password was correct.
+func (am *AccountManager) checkTwoFactorCode(cfname, code string) (err error) {
+	if am.server.CheckTwoFactor(fmt.Sprintf(keyAccountTOTP, cfname), code) != nil {
+		return errAccountInvalidCredentials
+	}
+	return nil
+}
+
 // AllNicks returns the uncasefolded nicknames for all accounts, including additional (grouped) nicks.
 func (am *AccountManager) AllNicks() (result []string) {
 	accountNamePrefix := fmt.Sprintf(keyAccountName, "")
@@ -1482,6 +1573,76 @@ func (am *AccountManager) LoadAccount(accountName string) (result ClientAccount,
 	return
 }
 
+// accountDataExport is the account holder's copy of the data stored about an account,
+// as produced by NS EXPORT; it omits the password hash.
+type accountDataExport struct {
+	Name               string          `json:"name"`
+	NameCasefolded     string          `json:"-"`
+	RegisteredAt       time.Time       `json:"registered_at"`
+	Verified           bool            `json:"verified"`
+	Email              string          `json:"email,omitempty"`
+	AdditionalNicks    []string        `json:"additional_nicks,omitempty"`
+	VHost              string          `json:"vhost,omitempty"`
+	Certfps            []string        `json:"certfps,omitempty"`
+	RegisteredChannels []string        `json:"registered_channels,omitempty"`
+	Settings           AccountSettings `json:"settings"`
+}
+
+type accountRequestType uint
+
+const (
+	accountRequestExport        accountRequestType = iota // an actual export, by an operator
+	accountRequestExportRequest                           // an account holder's request for an export
+	accountRequestErasure                                 // an account holder's request for erasure
+)
+
+type accountRequest struct {
+	cfaccount string
+	kind      accountRequestType
+}
+
+// touchRequest records an export of an account's data, or a request by the
+// account holder, returning false if there was already one of the same type
+// within accountRequestInterval.
+func (am *AccountManager) touchRequest(cfaccount string, kind accountRequestType) (allowed bool) {
+	key := accountRequest{cfaccount: cfaccount, kind: kind}
+	now := time.Now().UTC()
+
+	am.Lock()
+	defer am.Unlock()
+
+	for request, requestTime := range am.requestTimes {
+		if now.Sub(requestTime) >= accountRequestInterval {
+			delete(am.requestTimes, request)
+		}
+	}
+	if _, ok := am.requestTimes[key]; ok {
+		return false
+	}
+	am.requestTimes[key] = now
+	return true
+}
+
+func (am *AccountManager) ExportAccountData(accountName string) (result accountDataExport, err error) {
+	account, err := am.LoadAccount(accountName)
+	if err != nil {
+		return
+	}
+	result = accountDataExport{
+		Name:               account.Name,
+		NameCasefolded:     account.NameCasefolded,
+		RegisteredAt:       account.RegisteredAt,
+		Verified:           account.Verified,
+		Email:              account.Settings.Email,
+		AdditionalNicks:    account.AdditionalNicks,
+		VHost:              account.VHost.ApprovedVHost,
+		Certfps:            account.Credentials.Certfps,
+		RegisteredChannels: am.server.channels.ChannelsForAccount(account.NameCasefolded),
+		Settings:           account.Settings,
+	}
+	return
+}
+
 func (am *AccountManager) accountWasUnregistered(accountName string) (result bool) {
 	casefoldedAccount, err := CasefoldName(accountName)
 	if err != nil {
@@ -1592,6 +1753,51 @@ func (am *AccountManager) loadRawAccount(tx *buntdb.Tx, casefoldedAccount string
 	return
 }
 
+// ListAccounts returns up to `limit` accounts whose casefolded names sort after
+// `after`, in order. It walks the database keys in order, so only a single page
+// of accounts is ever loaded; `more` is set if there are further accounts.
+func (am *AccountManager) ListAccounts(after string, limit int) (accounts []ClientAccount, more bool, err error) {
+	existsPrefix := fmt.Sprintf(keyAccountExists, "")
+	var cfnames []string
+	err = am.server.store.View(func(tx *buntdb.Tx) error {
+		return tx.AscendGreaterOrEqual("", existsPrefix+after, func(key, value string) bool {
+			if !strings.HasPrefix(key, existsPrefix) {
+				return false
+			}
+			cfname := strings.TrimPrefix(key, existsPrefix)
+			if cfname == after {
+				return true
+			}
+			if len(cfnames) == limit {
+				more = true
+				return false
+			}
+			cfnames = append(cfnames, cfname)
+			return true
+		})
+	})
+	if err != nil {
+		return
+	}
+
+	accounts = make([]ClientAccount, 0, len(cfnames))
+	for _, cfname := range cfnames {
+		var raw rawClientAccount
+		loadErr := am.server.store.View(func(tx *buntdb.Tx) (err error) {
+			raw, err = am.loadRawAccount(tx, cfname)
+			return
+		})
+		if loadErr != nil {
+			// deleted since we listed it
+			continue
+		}
+		if account, err := am.deserializeRawAccount(raw, cfname); err == nil {
+			accounts = append(accounts, account)
+		}
+	}
+	return
+}
+
 type AccountSuspension struct {
 	AccountName string `json:"AccountName,omitempty"`
 	TimeCreated time.Time
@@ -1773,6 +1979,7 @@ func (am *AccountManager) Unregister(account string, erase bool) error {
 	suspendedKey := fmt.Sprintf(keyAccountSuspended, casefoldedAccount)
 	pwResetKey := fmt.Sprintf(keyAccountPwReset, casefoldedAccount)
 	emailChangeKey := fmt.Sprintf(keyAccountEmailChange, casefoldedAccount)
+	totpKey := fmt.Sprintf(keyAccountTOTP, casefoldedAccount)
 
 	var clients []*Client
 	defer func() {
@@ -1831,6 +2038,7 @@ func (am *AccountManager) Unregister(account string, erase bool) error {
 		tx.Delete(suspendedKey)
 		tx.Delete(pwResetKey)
 		tx.Delete(emailChangeKey)
+		tx.Delete(totpKey)
 
 		return nil
 	})
@@ -2333,6 +2541,10 @@ type AccountSettings struct {
 	DMHistory        HistoryStatus
 	AutoAway         PersistentStatus
 	Email            string
+	// display role assigned by an operator (e.g., "network helper"), shown in WHOIS
+	Badge string
+	// IANA timezone name for timestamps in service replies (UTC if empty)
+	Timezone string
 }
 
 // ClientAccount represents a user account.
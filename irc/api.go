@@ -0,0 +1,502 @@
+package irc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ergochat/irc-go/ircfmt"
+
+	"github.com/ergochat/ergo/irc/connection_limits"
+	"github.com/ergochat/ergo/irc/modes"
+)
+
+// APIConfig controls the optional HTTP listener serving read-only
+// information about the server, e.g., for embedding on a network's website.
+type APIConfig struct {
+	Enabled          bool
+	Listener         string
+	CacheDuration    time.Duration `yaml:"cache-duration"`
+	MaxRequests      int           `yaml:"max-requests-per-minute"`
+	ChannelDirectory bool          `yaml:"channel-directory"`
+	Stats            bool
+	// tokens granting access to the administrative endpoints
+	BearerTokens []string `yaml:"bearer-tokens"`
+}
+
+// apiDirectoryEntry is the public information about a single channel.
+type apiDirectoryEntry struct {
+	Name     string `json:"name"`
+	Users    int    `json:"users"`
+	Topic    string `json:"topic"`
+	Language string `json:"language,omitempty"`
+	Category string `json:"category,omitempty"`
+}
+
+type apiDirectory struct {
+	Generated time.Time           `json:"generated"`
+	Channels  []apiDirectoryEntry `json:"channels"`
+}
+
+// apiStats is the public summary of the server's size; it contains no
+// information about individual users.
+type apiStats struct {
+	Users    int            `json:"users"`
+	MaxUsers int            `json:"max_users"`
+	Channels int            `json:"channels"`
+	Uptime   int64          `json:"uptime"`
+	Counts   map[string]int `json:"channel_users,omitempty"`
+}
+
+// maximum number of channels that can be queried in a single stats request
+const apiMaxStatsChannels = 16
+
+const (
+	// page sizes for the administrative listings
+	apiDefaultPageSize = 100
+	apiMaxPageSize     = 1000
+)
+
+// apiAccountEntry describes a registered account, for the administrative listing.
+type apiAccountEntry struct {
+	Name         string    `json:"name"`
+	RegisteredAt time.Time `json:"registered_at"`
+	Verified     bool      `json:"verified"`
+	Suspended    bool      `json:"suspended,omitempty"`
+}
+
+// apiRegisteredChannelEntry describes a registered channel, for the administrative listing.
+type apiRegisteredChannelEntry struct {
+	Name         string    `json:"name"`
+	Founder      string    `json:"founder"`
+	RegisteredAt time.Time `json:"registered_at"`
+}
+
+// apiPage is one page of an administrative listing; to fetch the next page,
+// pass `next` as the `after` parameter. `next` is omitted on the last page.
+type apiPage[T any] struct {
+	Entries []T    `json:"entries"`
+	Next    string `json:"next,omitempty"`
+}
+
+// apiCache holds the most recently generated response bodies; everything
+// served from the public endpoints is computed at most once per cache-duration.
+type apiCache struct {
+	sync.Mutex
+	throttle connection_limits.GenericThrottle
+
+	directoryGenerated time.Time
+	directoryJSON      []byte
+	directoryHTML      []byte
+}
+
+var apiDirectoryTemplate = template.Must(template.New("directory").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Network}} channels</title>
+</head>
+<body>
+<h1>{{.Network}} channels</h1>
+<table>
+<tr><th>Channel</th><th>Users</th><th>Topic</th></tr>
+{{range .Channels}}<tr><td>{{.Name}}</td><td>{{.Users}}</td><td>{{.Topic}}</td></tr>
+{{end}}</table>
+<p>Generated at {{.Generated.Format "2006-01-02 15:04:05 MST"}}</p>
+</body>
+</html>
+`))
+
+func (server *Server) setupAPIListener(config *Config) {
+	listener := config.API.Listener
+	if !config.API.Enabled {
+		listener = ""
+	}
+
+	server.apiCache.Lock()
+	server.apiCache.throttle = connection_limits.GenericThrottle{
+		Duration: time.Minute,
+		Limit:    config.API.MaxRequests,
+	}
+	// discard anything generated under the old config
+	server.apiCache.directoryGenerated = time.Time{}
+	server.apiCache.Unlock()
+
+	if server.apiServer != nil {
+		if listener == "" || (listener != server.apiServer.Addr) {
+			server.logger.Info("server", "Stopping API listener", server.apiServer.Addr)
+			server.apiServer.Close()
+			server.apiServer = nil
+		}
+	}
+	if listener != "" && server.apiServer == nil {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/v1/channels", server.apiChannelDirectoryHandler(false))
+		mux.HandleFunc("/channels", server.apiChannelDirectoryHandler(true))
+		mux.HandleFunc("/v1/stats", server.apiStatsHandler)
+		mux.HandleFunc("/v1/channel_history", server.apiAuthenticated("channel_history", server.apiChannelHistoryHandler))
+		mux.HandleFunc("/v1/accounts", server.apiAuthenticated("accounts", server.apiAccountsHandler))
+		mux.HandleFunc("/v1/registered_channels", server.apiAuthenticated("registered_channels", server.apiRegisteredChannelsHandler))
+		mux.HandleFunc("/v1/metrics", server.apiAuthenticated("metrics", server.apiMetricsHandler))
+		as := http.Server{
+			Addr:         listener,
+			Handler:      mux,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		}
+		go func() {
+			if err := as.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				server.logger.Error("server", "API listener failed", err.Error())
+			}
+		}()
+		server.apiServer = &as
+		server.logger.Info("server", "Started API listener", server.apiServer.Addr)
+	}
+}
+
+// apiThrottled checks the global request rate limit, replying with a 429
+// if it has been exceeded.
+func (server *Server) apiThrottled(w http.ResponseWriter) bool {
+	server.apiCache.Lock()
+	throttled, remaining := server.apiCache.throttle.Touch()
+	server.apiCache.Unlock()
+	if throttled {
+		w.Header().Set("Retry-After", strconv.Itoa(int(remaining.Seconds())+1))
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+	}
+	return throttled
+}
+
+func (server *Server) apiChannelDirectoryHandler(asHTML bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		config := server.Config()
+		if !config.API.ChannelDirectory {
+			http.NotFound(w, r)
+			return
+		}
+		if server.apiThrottled(w) {
+			return
+		}
+
+		jsonBody, htmlBody, err := server.apiChannelDirectory(config)
+		if err != nil {
+			server.logger.Error("internal", "couldn't generate channel directory", err.Error())
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if asHTML {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(htmlBody)
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Write(jsonBody)
+		}
+	}
+}
+
+// apiChannelDirectory returns the (possibly cached) directory of non-secret channels.
+func (server *Server) apiChannelDirectory(config *Config) (jsonBody, htmlBody []byte, err error) {
+	cache := &server.apiCache
+	cache.Lock()
+	defer cache.Unlock()
+
+	now := time.Now().UTC()
+	if cache.directoryJSON != nil && now.Sub(cache.directoryGenerated) < config.API.CacheDuration {
+		return cache.directoryJSON, cache.directoryHTML, nil
+	}
+
+	directory := apiDirectory{
+		Generated: now,
+		Channels:  make([]apiDirectoryEntry, 0),
+	}
+	for _, channel := range server.channels.ListableChannels() {
+		if channel.flags.HasMode(modes.Secret) {
+			continue
+		}
+		users, name, topic := channel.listData()
+		settings := channel.Settings()
+		directory.Channels = append(directory.Channels, apiDirectoryEntry{
+			Name:     name,
+			Users:    users,
+			Topic:    ircfmt.Strip(topic),
+			Language: settings.Language,
+			Category: settings.Category,
+		})
+	}
+	sort.Slice(directory.Channels, func(i, j int) bool {
+		if directory.Channels[i].Users != directory.Channels[j].Users {
+			return directory.Channels[i].Users > directory.Channels[j].Users
+		}
+		return directory.Channels[i].Name < directory.Channels[j].Name
+	})
+
+	jsonBody, err = json.Marshal(directory)
+	if err != nil {
+		return
+	}
+	var htmlBuf bytes.Buffer
+	err = apiDirectoryTemplate.Execute(&htmlBuf, struct {
+		apiDirectory
+		Network string
+	}{directory, config.Network.Name})
+	if err != nil {
+		return
+	}
+	htmlBody = htmlBuf.Bytes()
+
+	cache.directoryGenerated = now
+	cache.directoryJSON = jsonBody
+	cache.directoryHTML = htmlBody
+	return
+}
+
+// apiStatsHandler serves current user and channel counts, e.g., for an
+// "N users online" widget. Counts for individual (non-secret) channels can be
+// requested with ?channels=#a,#b
+func (server *Server) apiStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	config := server.Config()
+	// respect suppress-lusers: if the counts are hidden from users, hide them here too
+	if !config.API.Stats || config.Server.SuppressLusers {
+		http.NotFound(w, r)
+		return
+	}
+	if server.apiThrottled(w) {
+		return
+	}
+
+	values := server.stats.GetValues()
+	result := apiStats{
+		Users:    values.Total,
+		MaxUsers: values.Max,
+		Channels: server.channels.Len(),
+		Uptime:   int64(time.Since(server.ctime).Seconds()),
+	}
+	if chanList := r.URL.Query().Get("channels"); chanList != "" {
+		result.Counts = make(map[string]int)
+		for i, chname := range strings.Split(chanList, ",") {
+			if i == apiMaxStatsChannels {
+				break
+			}
+			channel := server.channels.Get(chname)
+			if channel == nil || channel.flags.HasMode(modes.Secret) {
+				continue
+			}
+			users, name, _ := channel.listData()
+			result.Counts[name] = users
+		}
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Write(body)
+}
+
+// apiAuthenticated wraps a handler for an administrative endpoint, requiring
+// either one of the configured bearer tokens or an API token with `scope`.
+func (server *Server) apiAuthenticated(scope string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || !server.checkAPIToken(token, scope) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// apiChannelHistoryHandler exports a channel's stored history, with the same
+// parameters as HISTSERV ARCHIVE: ?channel=#chan&format=jsonl&start=...&end=...
+func (server *Server) apiChannelHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	channel := server.channels.Get(query.Get("channel"))
+	if channel == nil {
+		http.Error(w, "no such channel", http.StatusNotFound)
+		return
+	}
+	var err error
+	format := archiveFormatJSONL
+	var start, end time.Time
+	if param := query.Get("format"); param != "" {
+		format, err = archiveFormatFromString(param)
+	}
+	if param := query.Get("start"); err == nil && param != "" {
+		start, err = parseArchiveTime(param)
+	}
+	if param := query.Get("end"); err == nil && param != "" {
+		end, err = parseArchiveTime(param)
+	}
+	if err != nil {
+		http.Error(w, "invalid parameters", http.StatusBadRequest)
+		return
+	}
+	sequence, err := server.channelArchiveSequence(channel)
+	if err == errInsufficientPrivs {
+		http.Error(w, "history for that channel is restricted", http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, "history is not enabled for that channel", http.StatusNotFound)
+		return
+	}
+	if !server.archiveInProgress.CompareAndSwap(false, true) {
+		http.Error(w, "another archive is already being written", http.StatusTooManyRequests)
+		return
+	}
+	defer server.archiveInProgress.Store(false)
+	// a large archive can take much longer to stream than the listener's WriteTimeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		server.logger.Error("internal", "couldn't lift API write deadline", err.Error())
+	}
+
+	if format == archiveFormatText {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/jsonl")
+	}
+	writer := bufio.NewWriter(w)
+	defer writer.Flush()
+	if _, err := writeChannelArchive(sequence, start, end, format, writer); err != nil {
+		server.logger.Error("history", "couldn't archive channel history", channel.Name(), err.Error())
+	}
+}
+
+// apiPageParams parses the keyset pagination parameters of an administrative
+// listing: ?after=<cursor>&limit=<n>. Cursors are casefolded names, so they
+// remain valid when entries are added or removed between requests.
+func apiPageParams(r *http.Request) (after string, limit int, err error) {
+	query := r.URL.Query()
+	after = query.Get("after")
+	limit = apiDefaultPageSize
+	if param := query.Get("limit"); param != "" {
+		limit, err = strconv.Atoi(param)
+		if err != nil || limit <= 0 {
+			return "", 0, errInvalidParams
+		}
+		if limit > apiMaxPageSize {
+			limit = apiMaxPageSize
+		}
+	}
+	return
+}
+
+func apiWriteJSON(w http.ResponseWriter, result any) {
+	body, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// apiAccountsHandler lists registered accounts, in order of casefolded name.
+func (server *Server) apiAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	after, limit, err := apiPageParams(r)
+	if err != nil {
+		http.Error(w, "invalid parameters", http.StatusBadRequest)
+		return
+	}
+	accounts, more, err := server.accounts.ListAccounts(after, limit)
+	if err != nil {
+		server.logger.Error("internal", "couldn't list accounts", err.Error())
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	page := apiPage[apiAccountEntry]{Entries: make([]apiAccountEntry, 0, len(accounts))}
+	for _, account := range accounts {
+		page.Entries = append(page.Entries, apiAccountEntry{
+			Name:         account.Name,
+			RegisteredAt: account.RegisteredAt,
+			Verified:     account.Verified,
+			Suspended:    account.Suspended != nil,
+		})
+	}
+	if more && len(accounts) != 0 {
+		page.Next = accounts[len(accounts)-1].NameCasefolded
+	}
+	apiWriteJSON(w, page)
+}
+
+// apiRegisteredChannelsHandler lists registered channels, in order of casefolded name.
+func (server *Server) apiRegisteredChannelsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	after, limit, err := apiPageParams(r)
+	if err != nil {
+		http.Error(w, "invalid parameters", http.StatusBadRequest)
+		return
+	}
+	channels, more := server.channels.ListRegisteredChannels(after, limit)
+
+	page := apiPage[apiRegisteredChannelEntry]{Entries: make([]apiRegisteredChannelEntry, 0, len(channels))}
+	for _, channel := range channels {
+		info := channel.ExportRegistration()
+		page.Entries = append(page.Entries, apiRegisteredChannelEntry{
+			Name:         info.Name,
+			Founder:      info.Founder,
+			RegisteredAt: info.RegisteredAt,
+		})
+	}
+	if more && len(channels) != 0 {
+		page.Next = channels[len(channels)-1].NameCasefolded()
+	}
+	apiWriteJSON(w, page)
+}
+
+// apiMetricsHandler serves the load signals as gauges in the Prometheus
+// text exposition format.
+func (server *Server) apiMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	status := server.LoadStatus()
+	stats := server.stats.GetValues()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	gauge := func(name, help string, value any) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", name, help, name, name, value)
+	}
+	gauge("ergo_scheduler_lag_seconds", "Delay in waking up from a short sleep.", status.SchedulerLag.Seconds())
+	gauge("ergo_goroutines", "Number of goroutines.", status.Goroutines)
+	gauge("ergo_heap_bytes", "Bytes of allocated heap objects.", status.HeapBytes)
+	gauge("ergo_last_gc_pause_seconds", "Duration of the most recent garbage collection pause.", status.LastGCPause.Seconds())
+	gauge("ergo_sessions", "Number of connected sessions.", status.Sessions)
+	gauge("ergo_sendq_saturated_sessions", "Sessions whose sendq is at least half full.", status.SaturatedSessions)
+	gauge("ergo_sendq_max_fraction", "Fullest sendq as a fraction of max-sendq.", status.MaxSendQFraction)
+	gauge("ergo_users", "Number of registered clients.", stats.Total)
+	gauge("ergo_unregistered_connections", "Number of connections that haven't completed registration.", stats.Unknown)
+}
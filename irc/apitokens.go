@@ -0,0 +1,144 @@
+package irc
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tidwall/buntdb"
+
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+const (
+	keyAPIToken = "api.tokenv1 %s"
+)
+
+// apiTokenScopes are the administrative API endpoints that a token can be
+// granted access to; a token with the "all" scope can access every endpoint.
+var apiTokenScopes = []string{"channel_history", "accounts", "registered_channels", "metrics"}
+
+// APITokenInfo describes an API token created with APITOKEN CREATE. Only a
+// hash of the token itself is stored.
+type APITokenInfo struct {
+	Name        string    `json:"name"`
+	Hash        string    `json:"hash"`
+	Scopes      []string  `json:"scopes"`
+	OperName    string    `json:"oper_name"`
+	TimeCreated time.Time `json:"time_created"`
+}
+
+// HasScope returns whether the token grants access to the given endpoint.
+func (info *APITokenInfo) HasScope(scope string) bool {
+	return slices.Contains(info.Scopes, "all") || slices.Contains(info.Scopes, scope)
+}
+
+func hashAPIToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// CreateAPIToken creates and stores a new API token, returning the token itself,
+// which cannot be recovered afterwards.
+func (server *Server) CreateAPIToken(name string, scopes []string, operName string) (token string, err error) {
+	name = strings.ToLower(name)
+	if name == "" || strings.ContainsAny(name, " *") {
+		return "", errAPITokenBadName
+	}
+	for _, scope := range scopes {
+		if scope != "all" && !slices.Contains(apiTokenScopes, scope) {
+			return "", errAPITokenBadScope
+		}
+	}
+
+	token = utils.GenerateSecretToken()
+	info := APITokenInfo{
+		Name:        name,
+		Hash:        hashAPIToken(token),
+		Scopes:      scopes,
+		OperName:    operName,
+		TimeCreated: time.Now().UTC(),
+	}
+	infoBytes, err := json.Marshal(info)
+	if err != nil {
+		return "", errAPITokenUnexpected
+	}
+
+	key := fmt.Sprintf(keyAPIToken, name)
+	err = server.store.Update(func(tx *buntdb.Tx) error {
+		if _, err := tx.Get(key); err == nil {
+			return errAPITokenExists
+		}
+		_, _, err := tx.Set(key, string(infoBytes), nil)
+		return err
+	})
+	if err == errAPITokenExists {
+		return "", err
+	} else if err != nil {
+		server.logger.Error("internal", "couldn't store API token", err.Error())
+		return "", errAPITokenUnexpected
+	}
+	return token, nil
+}
+
+// RevokeAPIToken deletes the named API token.
+func (server *Server) RevokeAPIToken(name string) (err error) {
+	key := fmt.Sprintf(keyAPIToken, strings.ToLower(name))
+	err = server.store.Update(func(tx *buntdb.Tx) error {
+		_, err := tx.Delete(key)
+		return err
+	})
+	if err == buntdb.ErrNotFound {
+		return errAPITokenNotFound
+	}
+	return err
+}
+
+// ListAPITokens returns all API tokens created with APITOKEN CREATE.
+func (server *Server) ListAPITokens() (result []APITokenInfo) {
+	prefix := fmt.Sprintf(keyAPIToken, "")
+	server.store.View(func(tx *buntdb.Tx) error {
+		tx.AscendGreaterOrEqual("", prefix, func(key, value string) bool {
+			if !strings.HasPrefix(key, prefix) {
+				return false
+			}
+			var info APITokenInfo
+			if err := json.Unmarshal([]byte(value), &info); err != nil {
+				server.logger.Error("internal", "bad API token data", key, err.Error())
+				return true
+			}
+			result = append(result, info)
+			return true
+		})
+		return nil
+	})
+	return
+}
+
+// checkAPIToken returns whether `token` is a valid API token for `scope`:
+// either one of the bearer tokens from the config file (which have every
+// scope), or a token created with APITOKEN CREATE that has the scope.
+func (server *Server) checkAPIToken(token, scope string) bool {
+	authorized := false
+	for _, validToken := range server.Config().API.BearerTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(validToken)) == 1 {
+			authorized = true
+		}
+	}
+	if authorized {
+		return true
+	}
+
+	hash := []byte(hashAPIToken(token))
+	for _, info := range server.ListAPITokens() {
+		if subtle.ConstantTimeCompare(hash, []byte(info.Hash)) == 1 {
+			return info.HasScope(scope)
+		}
+	}
+	return false
+}
@@ -7,7 +7,7 @@ package caps
 
 const (
 	// number of recognized capabilities:
-	numCapabs = 34
+	numCapabs = 35
 	// length of the uint32 array that represents the bitset:
 	bitsetLen = 2
 )
@@ -89,6 +89,10 @@ const (
 	// https://ircv3.net/specs/extensions/echo-message-3.2.html
 	EchoMessage Capability = iota
 
+	// IdleNotify is the Ergo vendor capability named "ergo.chat/idle-notify":
+	// https://github.com/ergochat/ergo/blob/master/docs/MANUAL.md#idle-notifications
+	IdleNotify Capability = iota
+
 	// Nope is the Ergo vendor capability named "ergo.chat/nope":
 	// https://ergo.chat/nope
 	Nope Capability = iota
@@ -172,6 +176,7 @@ var (
 		"draft/read-marker",
 		"draft/relaymsg",
 		"echo-message",
+		"ergo.chat/idle-notify",
 		"ergo.chat/nope",
 		"extended-join",
 		"extended-monitor",
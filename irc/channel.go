@@ -19,6 +19,7 @@ import (
 	"github.com/ergochat/ergo/irc/caps"
 	"github.com/ergochat/ergo/irc/datastore"
 	"github.com/ergochat/ergo/irc/history"
+	"github.com/ergochat/ergo/irc/linkpreview"
 	"github.com/ergochat/ergo/irc/modes"
 	"github.com/ergochat/ergo/irc/utils"
 )
@@ -26,6 +27,11 @@ import (
 type ChannelSettings struct {
 	History     HistoryStatus
 	QueryCutoff HistoryCutoff
+	// descriptive metadata for channel directories, filterable via LIST
+	Language string
+	Category string
+	// fetch and display the titles of linked web pages
+	LinkPreviews bool
 }
 
 // Channel represents a channel that clients can join.
@@ -48,9 +54,11 @@ type Channel struct {
 	userLimit         int
 	accountToUMode    map[string]modes.Mode
 	history           history.Buffer
-	stateMutex        sync.RWMutex // tier 1
-	writebackLock     sync.Mutex   // tier 1.5
-	joinPartMutex     sync.Mutex   // tier 3
+	modLog            ModLog
+	stateMutex        sync.RWMutex    // tier 1
+	writebackLock     sync.Mutex      // tier 1.5
+	writeback         writebackStatus // protected by writebackLock
+	joinPartMutex     sync.Mutex      // tier 3
 	dirtyBits         uint
 	settings          ChannelSettings
 	uuid              utils.UUID
@@ -216,6 +224,11 @@ func (channel *Channel) IsClean() bool {
 
 func (channel *Channel) wakeWriter() {
 	if channel.writebackLock.TryLock() {
+		if channel.writeback.retrying {
+			// the waiting write loop will pick up the new dirty bits
+			channel.writebackLock.Unlock()
+			return
+		}
 		go channel.writeLoop()
 	}
 }
@@ -223,10 +236,19 @@ func (channel *Channel) wakeWriter() {
 // equivalent of Socket.send()
 func (channel *Channel) writeLoop() {
 	for {
-		// TODO(#357) check the error value of this and implement timed backoff
-		channel.performWrite(0)
+		err := channel.performWrite(0)
+		delay := channel.server.writebackResult(channel.Name(), &channel.writeback, err)
+		channel.writeback.retrying = delay != 0
 		channel.writebackLock.Unlock()
 
+		if delay != 0 {
+			// the dirty bits were restored, so we'll try again after the delay
+			time.Sleep(delay)
+			channel.writebackLock.Lock()
+			channel.writeback.retrying = false
+			continue
+		}
+
 		channel.stateMutex.RLock()
 		isDirty := channel.dirtyBits != 0
 		isEmpty := len(channel.members) == 0
@@ -264,7 +286,9 @@ func (channel *Channel) Store(dirtyBits uint) (err error) {
 
 	channel.writebackLock.Lock()
 	defer channel.writebackLock.Unlock()
-	return channel.performWrite(dirtyBits)
+	err = channel.performWrite(dirtyBits)
+	channel.server.writebackResult(channel.Name(), &channel.writeback, err)
+	return
 }
 
 // do an individual write; equivalent of Socket.send()
@@ -279,19 +303,17 @@ func (channel *Channel) performWrite(additionalDirtyBits uint) (err error) {
 		return
 	}
 
-	var success bool
 	info := channel.ExportRegistration()
-	if b, err := info.Serialize(); err == nil {
-		if err := channel.server.dstore.Set(datastore.TableChannels, info.UUID, b, time.Time{}); err == nil {
-			success = true
-		} else {
+	var b []byte
+	if b, err = info.Serialize(); err == nil {
+		if err = channel.server.dstore.Set(datastore.TableChannels, info.UUID, b, time.Time{}); err != nil {
 			channel.server.logger.Error("internal", "couldn't persist channel", info.Name, err.Error())
 		}
 	} else {
 		channel.server.logger.Error("internal", "couldn't serialize channel", info.Name, err.Error())
 	}
 
-	if !success {
+	if err != nil {
 		channel.stateMutex.Lock()
 		channel.dirtyBits = channel.dirtyBits | dirtyBits
 		channel.stateMutex.Unlock()
@@ -672,7 +694,12 @@ func (channel *Channel) historyStatus(config *Config) (status HistoryStatus, tar
 		restrictions = config.History.Restrictions.queryCutoff
 	}
 
-	return channelHistoryStatus(config, registered, settings.History), target, restrictions
+	status = channelHistoryStatus(config, registered, settings.History)
+	if status == HistoryPersistent && isLocalChannelName(target) {
+		// local channels are never persisted
+		status = HistoryEphemeral
+	}
+	return status, target, restrictions
 }
 
 func (channel *Channel) joinTimeCutoff(client *Client) (present bool, cutoff time.Time) {
@@ -842,7 +869,11 @@ func (channel *Channel) Join(client *Client, key string, isSajoin bool, rb *Resp
 	var cache MessageCache
 	cache.Initialize(channel.server, message.Time, message.Msgid, details.nickMask, details.accountName, isBot, nil, "JOIN", chname)
 	isAway, awayMessage := client.Away()
+	smartFilter := channel.smartFilterApplies(givenMode)
 	for _, member := range channel.Members() {
+		if smartFilter && member != client && member.HasMode(modes.SmartFilter) {
+			continue
+		}
 		if respectAuditorium {
 			channel.stateMutex.RLock()
 			memberData, ok := channel.members[member]
@@ -1009,9 +1040,13 @@ func (channel *Channel) Part(client *Client, message string, rb *ResponseBuffer)
 	}
 	respectAuditorium := channel.flags.HasMode(modes.Auditorium) &&
 		clientData.modes.HighestChannelUserMode() == modes.Mode(0)
+	smartFilter := channel.smartFilterApplies(clientData.modes.HighestChannelUserMode())
 	var cache MessageCache
 	cache.Initialize(channel.server, splitMessage.Time, splitMessage.Msgid, details.nickMask, details.accountName, isBot, nil, "PART", params...)
 	for _, member := range channel.Members() {
+		if smartFilter && member.HasMode(modes.SmartFilter) {
+			continue
+		}
 		if respectAuditorium {
 			channel.stateMutex.RLock()
 			memberData, ok := channel.members[member]
@@ -1224,6 +1259,7 @@ func (channel *Channel) SetTopic(client *Client, topic string, rb *ResponseBuffe
 		Message:     message,
 		IsBot:       isBot,
 	}, details.account)
+	channel.recordModeration(client, "TOPIC", topic)
 
 	channel.MarkDirty(IncludeTopic)
 }
@@ -1286,17 +1322,20 @@ func msgCommandToHistType(command string) (history.ItemType, error) {
 	}
 }
 
-func (channel *Channel) SendSplitMessage(command string, minPrefixMode modes.Mode, clientOnlyTags map[string]string, client *Client, message utils.SplitMessage, rb *ResponseBuffer) {
+// SendSplitMessage relays a message to the channel. It returns whether the message
+// was relayed to every member, i.e., it was not refused, and was not restricted
+// to members with a minimum prefix (by STATUSMSG or +U).
+func (channel *Channel) SendSplitMessage(command string, minPrefixMode modes.Mode, clientOnlyTags map[string]string, client *Client, message utils.SplitMessage, rb *ResponseBuffer) (public bool) {
 	histType, err := msgCommandToHistType(command)
 	if err != nil {
-		return
+		return false
 	}
 
 	if canSpeak, mode := channel.CanSpeak(client); !canSpeak {
 		if histType != history.Notice {
 			rb.Add(nil, client.server.name, ERR_CANNOTSENDTOCHAN, client.Nick(), channel.Name(), fmt.Sprintf(client.t("Cannot send to channel (+%s)"), mode))
 		}
-		return
+		return false
 	}
 
 	isCTCP := message.IsRestrictedCTCPMessage()
@@ -1304,7 +1343,18 @@ func (channel *Channel) SendSplitMessage(command string, minPrefixMode modes.Mod
 		if histType != history.Notice {
 			rb.Add(nil, client.server.name, ERR_CANNOTSENDTOCHAN, client.Nick(), channel.Name(), fmt.Sprintf(client.t("Cannot send to channel (+%s)"), "C"))
 		}
-		return
+		return false
+	}
+
+	// +T and +A don't apply to halfops and above, so they can still make announcements
+	if (channel.flags.HasMode(modes.NoNotice) && histType == history.Notice) ||
+		(channel.flags.HasMode(modes.NoAction) && message.IsActionMessage()) {
+		if !channel.ClientIsAtLeast(client, modes.Halfop) {
+			if histType != history.Notice {
+				rb.Add(nil, client.server.name, ERR_CANNOTSENDTOCHAN, client.Nick(), channel.Name(), fmt.Sprintf(client.t("Cannot send to channel (+%s)"), "A"))
+			}
+			return false
+		}
 	}
 
 	details := client.Details()
@@ -1314,7 +1364,7 @@ func (channel *Channel) SendSplitMessage(command string, minPrefixMode modes.Mod
 	if !client.server.Config().Server.Compatibility.allowTruncation {
 		if !validateSplitMessageLen(histType, details.nickMask, chname, message) {
 			rb.Add(nil, client.server.name, ERR_INPUTTOOLONG, details.nick, client.t("Line too long to be relayed without truncation"))
-			return
+			return false
 		}
 	}
 
@@ -1370,6 +1420,7 @@ func (channel *Channel) SendSplitMessage(command string, minPrefixMode modes.Mod
 			IsBot:       isBot,
 		}, details.account)
 	}
+	return minPrefixMode == modes.Mode(0)
 }
 
 func (channel *Channel) applyModeToMember(client *Client, change modes.ModeChange, rb *ResponseBuffer) (applied bool, result modes.ModeChange) {
@@ -1416,7 +1467,9 @@ func (channel *Channel) ShowMaskList(client *Client, mode modes.Mode, rb *Respon
 
 	nick := client.Nick()
 	chname := channel.Name()
-	for mask, info := range channel.lists[mode].Masks() {
+	masks, infos := channel.lists[mode].SortedMasks()
+	for i, mask := range masks {
+		info := infos[i]
 		rb.Add(nil, client.server.name, rpllist, nick, chname, mask, info.CreatorNickmask, strconv.FormatInt(info.TimeCreated.Unix(), 10))
 	}
 
@@ -1481,6 +1534,7 @@ func (channel *Channel) Kick(client *Client, target *Client, comment string, rb
 	}
 	histItem.Params[0] = targetNick
 	channel.AddHistoryItem(histItem, details.account)
+	channel.recordModeration(client, "KICK", targetNick, comment)
 
 	channel.Quit(target)
 }
@@ -1617,9 +1671,79 @@ func (channel *Channel) auditoriumFriends(client *Client) (friends []*Client) {
 	return
 }
 
+// smartFilterApplies returns whether members with user mode +J should be spared
+// the joins, parts, and quits of a member with the given highest channel mode.
+func (channel *Channel) smartFilterApplies(highestMode modes.Mode) bool {
+	if highestMode != modes.Mode(0) {
+		return false
+	}
+	threshold := channel.server.Config().Channels.SmartFilterThreshold
+	channel.stateMutex.RLock()
+	defer channel.stateMutex.RUnlock()
+	return threshold <= len(channel.members)
+}
+
+// presenceFriends returns the members who should see the client quit.
+func (channel *Channel) presenceFriends(client *Client) (friends []*Client) {
+	friends = channel.auditoriumFriends(client)
+	if !channel.smartFilterApplies(channel.HighestUserMode(client)) {
+		return
+	}
+	filtered := make([]*Client, 0, len(friends))
+	for _, member := range friends {
+		if !member.HasMode(modes.SmartFilter) {
+			filtered = append(filtered, member)
+		}
+	}
+	return filtered
+}
+
 // data for RPL_LIST
 func (channel *Channel) listData() (memberCount int, name, topic string) {
 	channel.stateMutex.RLock()
 	defer channel.stateMutex.RUnlock()
 	return len(channel.members), channel.name, channel.topic
 }
+
+// sendSplitMessageAndPreview relays a message to the channel with SendSplitMessage,
+// then previews its links, unless it was refused or only some members saw it.
+// It returns whether a link preview was started.
+func (channel *Channel) sendSplitMessageAndPreview(command string, histType history.ItemType, minPrefixMode modes.Mode, clientOnlyTags map[string]string, client *Client, message utils.SplitMessage, rb *ResponseBuffer) (previewed bool) {
+	public := channel.SendSplitMessage(command, minPrefixMode, clientOnlyTags, client, message, rb)
+	if public && histType == history.Privmsg {
+		return channel.previewLinks(message)
+	}
+	return false
+}
+
+// previewLinks asynchronously fetches the title of the first web page linked in
+// a message, if the channel has opted in, and sends it to the channel as a notice.
+// It returns whether a fetch was started.
+func (channel *Channel) previewLinks(message utils.SplitMessage) (started bool) {
+	server := channel.server
+	if !server.Config().Server.LinkPreviews.Enabled || !channel.Settings().LinkPreviews {
+		return false
+	}
+	text := message.Message
+	if !message.Is512() {
+		text = message.Split[0].Message
+	}
+	url := linkpreview.FindURL(text)
+	if url == "" {
+		return false
+	}
+	go func() {
+		title := server.linkPreviews.Title(url)
+		if title == "" {
+			return
+		}
+		notice := fmt.Sprintf("[Link] %s", title)
+		chname := channel.Name()
+		for _, member := range channel.Members() {
+			for _, session := range member.Sessions() {
+				session.Send(nil, server.name, "NOTICE", chname, notice)
+			}
+		}
+	}()
+	return true
+}
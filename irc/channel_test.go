@@ -0,0 +1,124 @@
+package irc
+
+import (
+	"testing"
+
+	"github.com/ergochat/ergo/irc/history"
+	"github.com/ergochat/ergo/irc/languages"
+	"github.com/ergochat/ergo/irc/modes"
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+// link previews are only sent for PRIVMSGs that were relayed to every
+// member of the channel
+func TestLinkPreviewRestrictions(t *testing.T) {
+	server := &Server{
+		name: "ergo.test",
+	}
+	lm, err := languages.NewManager(false, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{
+		languageManager: lm,
+	}
+	config.Server.Compatibility.allowTruncation = true
+	config.Server.LinkPreviews.Enabled = true
+	server.config.Store(config)
+	server.linkPreviews.ApplyConfig(config.Server.LinkPreviews)
+	channel := NewChannel(server, "#test", "#test", false, RegisteredChannel{})
+	channel.settings.LinkPreviews = true
+
+	sender := &Client{
+		server:             server,
+		nick:               "alice",
+		nickCasefolded:     "alice",
+		nickMaskCasefolded: "alice!u@localhost",
+	}
+	op := &Client{
+		server:             server,
+		nick:               "bob",
+		nickCasefolded:     "bob",
+		nickMaskCasefolded: "bob!u@localhost",
+	}
+	rb := NewResponseBuffer(&Session{client: sender})
+	channel.members.Add(sender)
+	channel.members.Add(op)
+	channel.members[op].modes.SetMode(modes.ChannelOperator, true)
+	channel.regenerateMembersCache()
+
+	// a loopback URL, which the previewer will refuse to fetch
+	message := utils.MakeMessage("see http://127.0.0.1/")
+	ctcp := utils.MakeMessage("\x01PING http://127.0.0.1/\x01")
+	noLink := utils.MakeMessage("hello")
+	send := func(client *Client, histType history.ItemType, minPrefixMode modes.Mode, message utils.SplitMessage, rb *ResponseBuffer) bool {
+		return channel.sendSplitMessageAndPreview("PRIVMSG", histType, minPrefixMode, nil, client, message, rb)
+	}
+
+	assertEqual(send(sender, history.Privmsg, 0, message, rb), true)
+	assertEqual(send(sender, history.Privmsg, 0, noLink, rb), false)
+	assertEqual(send(sender, history.Notice, 0, message, rb), false)
+	// STATUSMSG, e.g. to @#test
+	assertEqual(send(sender, history.Privmsg, modes.ChannelOperator, message, rb), false)
+
+	// +C
+	channel.flags.SetMode(modes.NoCTCP, true)
+	assertEqual(send(sender, history.Privmsg, 0, ctcp, rb), false)
+	channel.flags.SetMode(modes.NoCTCP, false)
+
+	// +U: unprivileged members' messages only go to ops
+	channel.flags.SetMode(modes.OpModerated, true)
+	assertEqual(send(sender, history.Privmsg, 0, message, rb), false)
+	channel.flags.SetMode(modes.OpModerated, false)
+
+	// +m
+	channel.flags.SetMode(modes.Moderated, true)
+	assertEqual(send(sender, history.Privmsg, 0, message, rb), false)
+	assertEqual(send(op, history.Privmsg, 0, message, rb), true)
+	channel.flags.SetMode(modes.Moderated, false)
+
+	// muted with a ban
+	channel.lists[modes.BanMask].Add("m:alice!*@*", "bob", "")
+	assertEqual(send(sender, history.Privmsg, 0, message, rb), false)
+	channel.lists[modes.BanMask].Remove("m:alice!*@*")
+
+	// banned users can't join, so they can only speak from outside (+n)
+	outsider := &Client{
+		server:             server,
+		nick:               "mallory",
+		nickCasefolded:     "mallory",
+		nickMaskCasefolded: "mallory!u@localhost",
+	}
+	channel.flags.SetMode(modes.NoOutside, true)
+	assertEqual(send(outsider, history.Privmsg, 0, message, NewResponseBuffer(&Session{client: outsider})), false)
+
+	// the channel hasn't opted in
+	channel.flags.SetMode(modes.NoOutside, false)
+	channel.settings.LinkPreviews = false
+	assertEqual(send(sender, history.Privmsg, 0, message, rb), false)
+}
+
+func TestRenameChannelType(t *testing.T) {
+	var cm ChannelManager
+	assertEqual(cm.Rename("#test", "&test"), errInvalidChannelName)
+	assertEqual(cm.Rename("&test", "#test"), errInvalidChannelName)
+	assertEqual(cm.Rename("#test", "&#test"), errInvalidChannelName)
+}
+
+func TestChannelTags(t *testing.T) {
+	tag, err := channelTagFromString("pt-BR", maxChannelLanguageLen)
+	assertEqual(tag, "pt-br")
+	assertEqual(err, nil)
+	tag, err = channelTagFromString("None", maxChannelLanguageLen)
+	assertEqual(tag, "")
+	assertEqual(err, nil)
+	_, err = channelTagFromString("two words", maxChannelCategoryLen)
+	assertEqual(err, errInvalidParams)
+	_, err = channelTagFromString("abcdefghijklmnopq", maxChannelLanguageLen)
+	assertEqual(err, errInvalidParams)
+
+	assertEqual(languageTagMatches("pt-br", "pt"), true)
+	assertEqual(languageTagMatches("pt-br", "pt-br"), true)
+	assertEqual(languageTagMatches("pt", "pt-br"), false)
+	assertEqual(languageTagMatches("ptx", "pt"), false)
+}
@@ -215,6 +215,9 @@ func (cm *ChannelManager) SetRegistered(channelName string, account string) (err
 	if err != nil {
 		return err
 	}
+	if isLocalChannelName(cfname) {
+		return errLocalChannel
+	}
 
 	var entry *channelManagerEntry
 
@@ -282,6 +285,12 @@ func (cm *ChannelManager) Rename(name string, newName string) (err error) {
 	if err != nil {
 		return errInvalidChannelName
 	}
+	// a channel can't change type: local channels are never persisted, so a
+	// registered # channel can't become one, and a & channel can't become a
+	// regular channel without going through registration checks
+	if isLocalChannelName(oldCfname) != isLocalChannelName(newCfname) {
+		return errInvalidChannelName
+	}
 	newSkeleton, err := Skeleton(newName)
 	if err != nil {
 		return errInvalidChannelName
@@ -509,3 +518,26 @@ func (cm *ChannelManager) AllRegisteredChannels() (result []string) {
 
 	return
 }
+
+// ListRegisteredChannels returns up to `limit` registered channels whose
+// casefolded names sort after `after`, in order; `more` is set if there
+// are further channels.
+func (cm *ChannelManager) ListRegisteredChannels(after string, limit int) (channels []*Channel, more bool) {
+	cm.RLock()
+	cfnames := make([]string, 0, len(cm.chans))
+	for cfname, entry := range cm.chans {
+		if after < cfname && entry.channel.Founder() != "" {
+			cfnames = append(cfnames, cfname)
+		}
+	}
+	sort.Strings(cfnames)
+	if len(cfnames) > limit {
+		cfnames, more = cfnames[:limit], true
+	}
+	channels = make([]*Channel, 0, len(cfnames))
+	for _, cfname := range cfnames {
+		channels = append(channels, cm.chans[cfname].channel)
+	}
+	cm.RUnlock()
+	return
+}
@@ -8,6 +8,7 @@ import (
 	"regexp"
 	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -46,6 +47,18 @@ this command if you're the founder of the channel.`,
 			enabled:   chanregEnabled,
 			minParams: 1,
 		},
+		"voice": {
+			handler: csVoiceHandler,
+			help: `Syntax: $bVOICE #channel [nickname]$b
+
+VOICE gives voice (+v) to the given nickname, or yourself. You can voice
+yourself if you're the founder or in the AMODEs of the channel; to voice
+someone else, you must be the founder or at least a halfop.`,
+			helpShort:    `$bVOICE$b gives voice to the given user (or yourself).`,
+			authRequired: true,
+			enabled:      chanregEnabled,
+			minParams:    1,
+		},
 		"register": {
 			handler: csRegisterHandler,
 			help: `Syntax: $bREGISTER #channel$b
@@ -148,6 +161,18 @@ INFO displays info about a registered channel.`,
 			helpShort: `$bINFO$b displays info about a registered channel.`,
 			enabled:   chanregEnabled,
 		},
+		"modlog": {
+			handler: csModlogHandler,
+			help: `Syntax: $bMODLOG #channel [count]$b
+
+MODLOG displays the most recent moderation events (kicks, topic changes, and
+mode changes, including bans) in a registered channel, with who performed them.
+It is available to the channel founder and to channel operators. Up to 100
+events are retained, but only while the server is running.`,
+			helpShort: `$bMODLOG$b displays recent moderation events in a channel.`,
+			enabled:   chanregEnabled,
+			minParams: 1,
+		},
 		"get": {
 			handler: csGetHandler,
 			help: `Syntax: $bGET #channel <setting>$b
@@ -183,6 +208,18 @@ by unprivileged users. Your options are:
                          channel; note that history will be effectively
                          unavailable to clients that are not always-on]
 4. 'default'            [use the server default]`,
+				`$bLANGUAGE$b
+'language' sets the language of the channel, as a language tag such as
+'en' or 'pt-BR', for use by channel directories. It can be used to filter
+channels, e.g. /LIST lang=en. To clear it, set it to 'none'.`,
+				`$bCATEGORY$b
+'category' sets a one-word category (such as 'gaming' or 'support') for use
+by channel directories. It can be used to filter channels, e.g.
+/LIST category=gaming. To clear it, set it to 'none'.`,
+				`$bLINK-PREVIEWS$b
+'link-previews' controls whether the server fetches the titles of web pages
+linked in the channel and displays them, if the server allows it. Your
+options are 'on' and 'off'.`,
 			},
 			enabled:   chanregEnabled,
 			minParams: 3,
@@ -359,6 +396,66 @@ func csOpHandler(service *ircService, server *Server, client *Client, command st
 	server.snomasks.Send(sno.LocalChannels, fmt.Sprintf(ircfmt.Unescape("Client $c[grey][$r%s$c[grey]] CS OP'd $c[grey][$r%s$c[grey]] in channel $c[grey][$r%s$c[grey]]"), client.NickMaskString(), tnick, channelName))
 }
 
+func csVoiceHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
+	channelInfo := server.channels.Get(params[0])
+	if channelInfo == nil {
+		service.Notice(rb, client.t("Channel does not exist"))
+		return
+	}
+	channelName := channelInfo.Name()
+	founder := channelInfo.Founder()
+
+	clientAccount := client.Account()
+	if clientAccount == "" {
+		service.Notice(rb, client.t("You're not logged into an account"))
+		return
+	}
+
+	var target *Client
+	if len(params) > 1 {
+		target = server.clients.Get(params[1])
+		if target == nil {
+			service.Notice(rb, client.t("Could not find given client"))
+			return
+		}
+	} else {
+		target = client
+	}
+
+	if clientAccount != founder {
+		if target == client {
+			if channelInfo.getAmode(clientAccount) == modes.Mode(0) {
+				service.Notice(rb, client.t("You don't have any stored privileges on that channel"))
+				return
+			}
+		} else if !channelInfo.ClientIsAtLeast(client, modes.Halfop) {
+			service.Notice(rb, client.t("Insufficient privileges"))
+			return
+		}
+	}
+
+	applied, change := channelInfo.applyModeToMember(client,
+		modes.ModeChange{Mode: modes.Voice,
+			Op:  modes.Add,
+			Arg: target.NickCasefolded(),
+		},
+		rb)
+	if !applied {
+		// applyModeToMember already sent ERR_USERNOTINCHANNEL if they aren't a member
+		if channelInfo.hasClient(target) {
+			service.Notice(rb, client.t("They already have voice"))
+		}
+		return
+	}
+	announceCmodeChanges(channelInfo, modes.ModeChanges{change}, server.name, "*", "", false, rb)
+
+	service.Notice(rb, client.t("Successfully granted voice"))
+
+	tnick := target.Nick()
+	server.logger.Info("services", fmt.Sprintf("Client %s voiced [%s] in channel %s", client.Nick(), tnick, channelName))
+	server.snomasks.Send(sno.LocalChannels, fmt.Sprintf(ircfmt.Unescape("Client $c[grey][$r%s$c[grey]] CS VOICE'd $c[grey][$r%s$c[grey]] in channel $c[grey][$r%s$c[grey]]"), client.NickMaskString(), tnick, channelName))
+}
+
 func csDeopHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
 	channel := server.channels.Get(params[0])
 	if channel == nil {
@@ -752,6 +849,33 @@ func csListHandler(service *ircService, server *Server, client *Client, command
 	service.Notice(rb, ircfmt.Unescape(client.t("*** $bEnd of ChanServ LIST$b ***")))
 }
 
+func csModlogHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
+	channel := server.channels.Get(params[0])
+	if channel == nil {
+		service.Notice(rb, client.t("Channel does not exist"))
+		return
+	}
+	if !channel.ClientIsAtLeast(client, modes.ChannelOperator) && !csPrivsCheck(service, channel.exportSummary(), client, rb) {
+		return
+	}
+
+	limit := 20
+	if len(params) > 1 {
+		count, err := strconv.Atoi(params[1])
+		if err != nil || count <= 0 {
+			service.Notice(rb, client.t("Invalid count"))
+			return
+		}
+		limit = min(count, channelModLogSize)
+	}
+
+	service.Notice(rb, fmt.Sprintf(ircfmt.Unescape(client.t("*** $bModeration log for %s$b ***")), channel.Name()))
+	for _, entry := range channel.modLog.Latest(limit) {
+		service.Notice(rb, fmt.Sprintf("%s  %s (%s): %s", client.formatTime(entry.Time), entry.Actor, entry.Account, entry.Action))
+	}
+	service.Notice(rb, ircfmt.Unescape(client.t("*** $bEnd of moderation log$b ***")))
+}
+
 func csInfoHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
 	if len(params) == 0 {
 		// #765
@@ -771,7 +895,7 @@ func csInfoHandler(service *ircService, server *Server, client *Client, command
 		if err == nil {
 			service.Notice(rb, fmt.Sprintf(client.t("Channel %s was purged by the server operators and cannot be used"), chname))
 			service.Notice(rb, fmt.Sprintf(client.t("Purged by operator: %s"), purgeRecord.Oper))
-			service.Notice(rb, fmt.Sprintf(client.t("Purged at: %s"), purgeRecord.PurgedAt.Format(time.RFC1123)))
+			service.Notice(rb, fmt.Sprintf(client.t("Purged at: %s"), client.formatTime(purgeRecord.PurgedAt)))
 			if purgeRecord.Reason != "" {
 				service.Notice(rb, fmt.Sprintf(client.t("Purge reason: %s"), purgeRecord.Reason))
 			}
@@ -795,7 +919,35 @@ func csInfoHandler(service *ircService, server *Server, client *Client, command
 	}
 	service.Notice(rb, fmt.Sprintf(client.t("Channel %s is registered"), chinfo.Name))
 	service.Notice(rb, fmt.Sprintf(client.t("Founder: %s"), chinfo.Founder))
-	service.Notice(rb, fmt.Sprintf(client.t("Registered at: %s"), chinfo.RegisteredAt.Format(time.RFC1123)))
+	service.Notice(rb, fmt.Sprintf(client.t("Registered at: %s"), client.formatTime(chinfo.RegisteredAt)))
+}
+
+const (
+	maxChannelLanguageLen = 16
+	maxChannelCategoryLen = 32
+)
+
+var (
+	validChannelTagRe = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+)
+
+// channelTagFromString validates a channel language or category;
+// "none" clears the setting
+func channelTagFromString(value string, maxLen int) (result string, err error) {
+	if strings.ToLower(value) == "none" {
+		return "", nil
+	}
+	if maxLen < len(value) || !validChannelTagRe.MatchString(value) {
+		return "", errInvalidParams
+	}
+	return strings.ToLower(value), nil
+}
+
+func channelTagToString(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
 }
 
 func displayChannelSetting(service *ircService, settingName string, settings ChannelSettings, client *Client, rb *ResponseBuffer) {
@@ -813,6 +965,18 @@ func displayChannelSetting(service *ircService, settingName string, settings Cha
 		}
 		service.Notice(rb, fmt.Sprintf(client.t("The stored channel history query cutoff setting is: %s"), historyCutoffToString(settings.QueryCutoff)))
 		service.Notice(rb, fmt.Sprintf(client.t("Given current server settings, the channel history query cutoff setting is: %s"), historyCutoffToString(effectiveValue)))
+	case "language":
+		service.Notice(rb, fmt.Sprintf(client.t("The channel language is: %s"), channelTagToString(settings.Language)))
+	case "category":
+		service.Notice(rb, fmt.Sprintf(client.t("The channel category is: %s"), channelTagToString(settings.Category)))
+	case "link-previews":
+		if !config.Server.LinkPreviews.Enabled {
+			service.Notice(rb, client.t("Link previews are disabled on this server"))
+		} else if settings.LinkPreviews {
+			service.Notice(rb, client.t("Link previews are enabled for this channel"))
+		} else {
+			service.Notice(rb, client.t("Link previews are disabled for this channel"))
+		}
 	default:
 		service.Notice(rb, client.t("Invalid params"))
 	}
@@ -863,6 +1027,25 @@ func csSetHandler(service *ircService, server *Server, client *Client, command s
 			break
 		}
 		channel.SetSettings(settings)
+	case "language":
+		settings.Language, err = channelTagFromString(value, maxChannelLanguageLen)
+		if err != nil {
+			break
+		}
+		channel.SetSettings(settings)
+	case "category":
+		settings.Category, err = channelTagFromString(value, maxChannelCategoryLen)
+		if err != nil {
+			break
+		}
+		channel.SetSettings(settings)
+	case "link-previews":
+		settings.LinkPreviews, err = utils.StringToBool(value)
+		if err != nil {
+			err = errInvalidParams
+			break
+		}
+		channel.SetSettings(settings)
 	}
 
 	switch err {
@@ -906,7 +1089,7 @@ func csHowToBanHandler(service *ircService, server *Server, client *Client, comm
 			return
 		}
 		service.Notice(rb, fmt.Sprintf(client.t("Warning: %s is not currently connected to the server. Using WHOWAS data, which may be inaccurate:"), nick))
-		details = whowasList[0]
+		details = whowasList[0].WhoWas
 	} else {
 		details = target.Details().WhoWas
 	}
@@ -6,11 +6,13 @@
 package irc
 
 import (
+	"crypto/tls"
 	"crypto/x509"
 	"fmt"
 	"maps"
 	"net"
 	"runtime/debug"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -49,7 +51,11 @@ const (
 const (
 	// RegisterTimeout is how long clients have to register before we disconnect them
 	RegisterTimeout = time.Minute
+	// DefaultHostnameLookupTimeout bounds reverse DNS lookups, including forward confirmation
+	// (the default for server.hostname-lookup-timeout)
+	DefaultHostnameLookupTimeout = 5 * time.Second
 	// DefaultIdleTimeout is how long without traffic before we send the client a PING
+	// (the default for server.keepalive.ping-interval)
 	DefaultIdleTimeout = time.Minute + 30*time.Second
 	// For Tor clients, we send a PING at least every 30 seconds, as a workaround for this bug
 	// (single-onion circuits will close unless the client sends data once every 60 seconds):
@@ -84,15 +90,18 @@ type Client struct {
 	isKlined           bool // #1941: k-line kills are special-cased to suppress some triggered notices/events
 	languages          []string
 	lastActive         time.Time            // last time they sent a command that wasn't PONG or similar
+	idleNotified       bool                 // whether an idle-notify was sent since lastActive
 	lastSeen           map[string]time.Time // maps device ID (including "") to time of last received command
 	readMarkers        map[string]time.Time // maps casefolded target to time of last read marker
 	loginThrottle      connection_limits.GenericThrottle
+	reportThrottle     connection_limits.GenericThrottle
 	nextSessionID      int64 // Incremented when a new session is established
 	nick               string
 	nickCasefolded     string
 	nickMaskCasefolded string
 	nickMaskString     string // cache for nickmask string since it's used with lots of replies
 	oper               *Oper
+	staffListed        bool // listed in STAFF as available for help
 	preregNick         string
 	proxiedIP          net.IP // actual remote IP if using the PROXY protocol
 	rawHostname        string
@@ -114,7 +123,8 @@ type Client struct {
 	vhost              string
 	history            history.Buffer
 	dirtyBits          uint
-	writebackLock      sync.Mutex // tier 1.5
+	writebackLock      sync.Mutex      // tier 1.5
+	writeback          writebackStatus // protected by writebackLock
 }
 
 type saslStatus struct {
@@ -146,9 +156,10 @@ type Session struct {
 
 	ctime      time.Time
 	lastActive time.Time // last non-CTCP PRIVMSG sent; updates publicly visible idle time
-	lastTouch  time.Time // last line sent; updates timer for idle timeouts
+	lastTouch  time.Time // last sign of life (any line, or only PONG with require-pong)
 	idleTimer  *time.Timer
-	pingSent   bool // we sent PING to a putatively idle connection and we're waiting for PONG
+	pingsSent  int       // unanswered PINGs sent to a putatively idle connection
+	lastPing   time.Time // when we sent the most recent of those PINGs
 
 	sessionID   int64
 	socket      *Socket
@@ -157,6 +168,11 @@ type Session struct {
 	rawHostname string
 	isTor       bool
 	hideSTS     bool
+	requireSASL bool // the listener requires SASL
+	keepalive   utils.KeepaliveOverrides
+	quietReg    bool   // skip LUSERS and MOTD during registration
+	motdFile    string // alternate MOTD set by the listener, if any
+	sniHostname string // TLS server name requested by the client, if any
 
 	fakelag              Fakelag
 	deferredFakelagCount int
@@ -351,16 +367,20 @@ func (server *Server) RunClient(conn IRCConn) {
 	}
 	client.history.Initialize(config.History.ClientLength, time.Duration(config.History.AutoresizeWindow))
 	session := &Session{
-		client:     client,
-		socket:     socket,
-		capVersion: caps.Cap301,
-		capState:   caps.NoneState,
-		ctime:      now,
-		lastActive: now,
-		realIP:     realIP,
-		proxiedIP:  proxiedIP,
-		isTor:      wConn.Tor,
-		hideSTS:    wConn.Tor || wConn.HideSTS,
+		client:      client,
+		socket:      socket,
+		capVersion:  caps.Cap301,
+		capState:    caps.NoneState,
+		ctime:       now,
+		lastActive:  now,
+		realIP:      realIP,
+		proxiedIP:   proxiedIP,
+		isTor:       wConn.Tor,
+		hideSTS:     wConn.Tor || wConn.HideSTS,
+		requireSASL: wConn.RequireSASL,
+		keepalive:   wConn.Keepalive,
+		quietReg:    wConn.Quiet,
+		motdFile:    wConn.MOTD,
 	}
 	client.sessions = []*Session{session}
 
@@ -373,6 +393,9 @@ func (server *Server) RunClient(conn IRCConn) {
 	if wConn.TLS {
 		// error is not useful to us here anyways so we can ignore it
 		session.certfp, session.peerCerts, _ = utils.GetCertFP(wConn.Conn, RegisterTimeout)
+		if tlsConn, ok := wConn.Conn.(*tls.Conn); ok {
+			session.sniHostname = strings.ToLower(tlsConn.ConnectionState().ServerName)
+		}
 	}
 
 	if session.isTor {
@@ -384,7 +407,13 @@ func (server *Server) RunClient(conn IRCConn) {
 		}
 	}
 
-	client.registrationTimer = time.AfterFunc(RegisterTimeout, client.handleRegisterTimeout)
+	registrationTimeout := config.Server.Keepalive.RegistrationTimeout
+	if wConn.Keepalive.RegistrationTimeout != 0 {
+		registrationTimeout = wConn.Keepalive.RegistrationTimeout
+	}
+	client.registrationTimer = time.AfterFunc(registrationTimeout, func() {
+		client.handleRegisterTimeout(registrationTimeout)
+	})
 	server.stats.Add()
 	client.run(session)
 }
@@ -494,7 +523,7 @@ func (client *Client) lookupHostname(session *Session, overwrite bool) {
 	lookupSuccessful := false
 	if config.Server.lookupHostnames {
 		session.Notice("*** Looking up your hostname...")
-		hostname, lookupSuccessful = utils.LookupHostname(ip, config.Server.ForwardConfirmHostnames)
+		hostname, lookupSuccessful = utils.LookupHostname(ip, config.Server.ForwardConfirmHostnames, config.Server.HostnameLookupTimeout)
 		if lookupSuccessful {
 			session.Notice("*** Found your hostname")
 		} else {
@@ -504,6 +533,18 @@ func (client *Client) lookupHostname(session *Session, overwrite bool) {
 		hostname = utils.IPStringToHostname(ip.String())
 	}
 
+	client.applyHostname(session, hostname, overwrite)
+}
+
+// applyHostname sets the session's (and possibly the client's) real hostname
+// and computes the corresponding cloak
+func (client *Client) applyHostname(session *Session, hostname string, overwrite bool) {
+	config := client.server.Config()
+	ip := session.realIP
+	if session.proxiedIP != nil {
+		ip = session.proxiedIP
+	}
+
 	session.rawHostname = hostname
 	cloakedHostname := config.Server.Cloaks.ComputeCloak(ip)
 	client.stateMutex.Lock()
@@ -550,6 +591,7 @@ const (
 	authFailPass
 	authFailTorSaslRequired
 	authFailSaslRequired
+	authFailTLSRequired
 )
 
 func (client *Client) isAuthorized(server *Server, config *Config, session *Session, forceRequireSASL bool) AuthOutcome {
@@ -562,6 +604,15 @@ func (client *Client) isAuthorized(server *Server, config *Config, session *Sess
 	if session.isTor && !saslSent && (config.Server.TorListeners.RequireSasl || server.Defcon() <= 4) {
 		return authFailTorSaslRequired
 	}
+	// some listeners and networks always require SASL, regardless of exemptions
+	if !saslSent && (session.requireSASL || utils.IPInNets(session.IP(), config.Accounts.RequireSasl.networks)) {
+		return authFailSaslRequired
+	}
+	// some accounts may only be used over TLS
+	if saslSent && !client.HasMode(modes.TLS) && config.Accounts.RequireTLS.accountMatcher != nil &&
+		config.Accounts.RequireTLS.accountMatcher.MatchString(client.account) {
+		return authFailTLSRequired
+	}
 	// finally, enforce require-sasl
 	if !saslSent && (forceRequireSASL || config.Accounts.RequireSasl.Enabled || server.Defcon() <= 2) &&
 		!utils.IPInNets(session.IP(), config.Accounts.RequireSasl.exemptedNets) {
@@ -635,7 +686,11 @@ func (client *Client) run(session *Session) {
 		var invalidUtf8 bool
 		line, err := session.socket.Read()
 		if err == errInvalidUtf8 {
-			invalidUtf8 = true // handle as normal, including labeling
+			if client.server.Config().Server.ReplaceInvalidUtf8 {
+				line = strings.ToValidUTF8(line, "\ufffd")
+			} else {
+				invalidUtf8 = true // handle as normal, including labeling
+			}
 		} else if err != nil {
 			client.server.logger.Debug("connect-ip", "read error from client", err.Error())
 			var quitMessage string
@@ -671,8 +726,9 @@ func (client *Client) run(session *Session) {
 
 		if client.registered {
 			// apply deferred fakelag
+			flooded := false
 			for i := 0; i < session.deferredFakelagCount; i++ {
-				session.fakelag.Touch("")
+				flooded = session.fakelag.Touch("") || flooded
 			}
 			session.deferredFakelagCount = 0
 			// touch for the current command
@@ -680,7 +736,12 @@ func (client *Client) run(session *Session) {
 			if err == nil {
 				command = msg.Command
 			}
-			session.fakelag.Touch(command)
+			flooded = session.fakelag.Touch(command) || flooded
+			if flooded {
+				client.server.logger.Info("connect-ip", "disconnecting flooding session of", client.Nick(), "from", session.IP().String())
+				client.Quit("Excess Flood", session)
+				break
+			}
 		} else {
 			// DoS hardening, #505
 			session.registrationMessages++
@@ -724,6 +785,10 @@ func (client *Client) run(session *Session) {
 }
 
 func (client *Client) playReattachMessages(session *Session) {
+	// don't hand operator status to a new session automatically, if so configured
+	if client.server.Config().Server.OperExpiration.OnReattach && client.HasMode(modes.Operator) {
+		client.expireOper("reattach")
+	}
 	client.server.playRegistrationBurst(session)
 	hasHistoryCaps := session.HasHistoryCaps()
 	for _, channel := range session.client.Channels() {
@@ -757,7 +822,7 @@ func (client *Client) Touch(session *Session) {
 	now := time.Now().UTC()
 	client.stateMutex.Lock()
 	if client.registered {
-		client.updateIdleTimer(session, now)
+		client.updateIdleTimer(session, now, false)
 		if client.alwaysOn {
 			client.setLastSeen(now, session.deviceID)
 			client.dirtyTimestamps = true
@@ -773,58 +838,91 @@ func (client *Client) setLastSeen(now time.Time, deviceID string) {
 	updateLRUMap(client.lastSeen, deviceID, now, maxDeviceIDsPerClient)
 }
 
-func (client *Client) updateIdleTimer(session *Session, now time.Time) {
-	session.lastTouch = now
-	session.pingSent = false
+func (client *Client) updateIdleTimer(session *Session, now time.Time, pong bool) {
+	config := client.server.Config()
+	if pong || !config.Server.Keepalive.RequirePong || session.idleTimer == nil {
+		session.lastTouch = now
+		session.pingsSent = 0
+	}
 
 	if session.idleTimer == nil {
-		pingTimeout := DefaultIdleTimeout
-		if session.isTor {
-			pingTimeout = TorIdleTimeout
-		}
-		session.idleTimer = time.AfterFunc(pingTimeout, session.handleIdleTimeout)
+		session.idleTimer = time.AfterFunc(session.pingInterval(config), session.handleIdleTimeout)
 	}
 }
 
-func (session *Session) handleIdleTimeout() {
-	totalTimeout := DefaultTotalTimeout
-	pingTimeout := DefaultIdleTimeout
-	if session.isTor {
-		pingTimeout = TorIdleTimeout
+// Pong records a PONG from the session, which is always a sign of life.
+func (client *Client) Pong(session *Session) {
+	client.stateMutex.Lock()
+	defer client.stateMutex.Unlock()
+	if client.registered {
+		client.updateIdleTimer(session, time.Now().UTC(), true)
+	}
+}
+
+func (session *Session) pingInterval(config *Config) time.Duration {
+	if session.keepalive.PingInterval != 0 {
+		return session.keepalive.PingInterval
+	} else if session.isTor {
+		return config.Server.Keepalive.TorPingInterval
 	}
+	return config.Server.Keepalive.PingInterval
+}
+
+func (session *Session) pingTimeout(config *Config) time.Duration {
+	if session.keepalive.PingTimeout != 0 {
+		return session.keepalive.PingTimeout
+	}
+	return config.Server.Keepalive.PingTimeout
+}
+
+func (session *Session) handleIdleTimeout() {
+	config := session.client.server.Config()
+	pingInterval := session.pingInterval(config)
+	pingTimeout := session.pingTimeout(config)
+	maxMissedPings := config.Server.Keepalive.MaxMissedPings
 
 	session.client.stateMutex.Lock()
 	now := time.Now()
-	timeUntilDestroy := session.lastTouch.Add(totalTimeout).Sub(now)
-	timeUntilPing := session.lastTouch.Add(pingTimeout).Sub(now)
-	shouldDestroy := session.pingSent && timeUntilDestroy <= 0
-	// XXX this should really be time <= 0, but let's do some hacky timer coalescing:
+	var shouldDestroy, shouldSendPing bool
+	var nextTimeout time.Duration
+	// XXX we round off the deadlines by PingCoalesceThreshold, as hacky timer coalescing:
 	// a typical idling client will do nothing other than respond immediately to our pings,
 	// so we'll PING at t=0, they'll respond at t=0.05, then we'll wake up at t=90 and find
 	// that we need to PING again at t=90.05. Rather than wake up again, just send it now:
-	shouldSendPing := !session.pingSent && timeUntilPing <= PingCoalesceThreshold
-	if !shouldDestroy {
-		if shouldSendPing {
-			session.pingSent = true
-		}
-		// check in again at the minimum of these 3 possible intervals:
-		// 1. the ping timeout (assuming we PING and they reply immediately with PONG)
-		// 2. the next time we would send PING (if they don't send any more lines)
-		// 3. the next time we would destroy (if they don't send any more lines)
-		nextTimeout := pingTimeout
-		if PingCoalesceThreshold < timeUntilPing && timeUntilPing < nextTimeout {
+	if session.pingsSent == 0 {
+		timeUntilPing := session.lastTouch.Add(pingInterval).Sub(now)
+		if timeUntilPing <= PingCoalesceThreshold {
+			shouldSendPing = true
+			nextTimeout = pingTimeout
+		} else {
 			nextTimeout = timeUntilPing
 		}
-		if 0 < timeUntilDestroy && timeUntilDestroy < nextTimeout {
-			nextTimeout = timeUntilDestroy
+	} else {
+		timeUntilDeadline := session.lastPing.Add(pingTimeout).Sub(now)
+		if timeUntilDeadline <= PingCoalesceThreshold {
+			if maxMissedPings <= session.pingsSent {
+				shouldDestroy = true
+			} else {
+				shouldSendPing = true
+				nextTimeout = pingTimeout
+			}
+		} else {
+			nextTimeout = timeUntilDeadline
 		}
+	}
+	if shouldSendPing {
+		session.pingsSent++
+		session.lastPing = now
+	}
+	if !shouldDestroy {
 		session.idleTimer.Stop()
 		session.idleTimer.Reset(nextTimeout)
 	}
+	idleTime := now.Sub(session.lastTouch).Truncate(time.Second)
 	session.client.stateMutex.Unlock()
 
 	if shouldDestroy {
-		session.client.Quit(fmt.Sprintf("Ping timeout: %v", totalTimeout), session)
+		session.client.Quit(fmt.Sprintf("Ping timeout: no response for %v", idleTime), session)
 		session.client.destroy(session)
 	} else if shouldSendPing {
 		session.Ping()
@@ -918,6 +1016,19 @@ func (client *Client) IdleTime() time.Duration {
 	return time.Since(client.lastActive)
 }
 
+// checkIdle returns whether the client has newly become idle, i.e., has been
+// idle for longer than `threshold` since the last time it was active.
+func (client *Client) checkIdle(threshold time.Duration) (idleTime time.Duration, becameIdle bool) {
+	client.stateMutex.Lock()
+	defer client.stateMutex.Unlock()
+	idleTime = time.Since(client.lastActive)
+	if client.registered && !client.idleNotified && threshold < idleTime {
+		client.idleNotified = true
+		becameIdle = true
+	}
+	return
+}
+
 // SignonTime returns this client's signon time as a unix timestamp.
 func (client *Client) SignonTime() int64 {
 	return client.ctime.Unix()
@@ -1022,6 +1133,7 @@ func (client *Client) SetOper(oper *Oper) {
 	client.stateMutex.Lock()
 	defer client.stateMutex.Unlock()
 	client.oper = oper
+	client.staffListed = oper != nil && oper.Staff
 	// operators typically get a vhost, update the nickmask
 	client.updateNickMaskNoMutex()
 }
@@ -1313,7 +1425,7 @@ func (client *Client) destroy(session *Session) {
 	friends := make(ClientSet)
 	channels = client.Channels()
 	for _, channel := range channels {
-		for _, member := range channel.auditoriumFriends(client) {
+		for _, member := range channel.presenceFriends(client) {
 			friends.Add(member)
 		}
 		channel.Quit(client)
@@ -1347,7 +1459,7 @@ func (client *Client) destroy(session *Session) {
 
 	if registered {
 		if !isKlined {
-			client.server.snomasks.Send(sno.LocalQuits, fmt.Sprintf(ircfmt.Unescape("%s$r exited the network"), details.nick))
+			client.server.snomasks.SendAggregated(sno.LocalQuits, client.IP().String(), fmt.Sprintf(ircfmt.Unescape("%s$r exited the network"), details.nick))
 			client.server.logger.Info("quit", fmt.Sprintf("%s is no longer on the server", details.nick))
 		}
 	}
@@ -1585,6 +1697,34 @@ func (client *Client) Uninvite(casefoldedChannel string) {
 	delete(client.invitedTo, casefoldedChannel)
 }
 
+// PendingInvites returns the names of the channels the client has been invited
+// to and could still join using the invite.
+func (client *Client) PendingInvites() (result []string) {
+	config := client.server.Config()
+	expTime := time.Duration(config.Channels.InviteExpiration)
+	now := time.Now().UTC()
+
+	client.stateMutex.Lock()
+	invites := make(map[string]channelInvite, len(client.invitedTo))
+	for chcfname, invite := range client.invitedTo {
+		if expTime != time.Duration(0) && now.Sub(invite.invitedAt) >= expTime {
+			delete(client.invitedTo, chcfname)
+		} else {
+			invites[chcfname] = invite
+		}
+	}
+	client.stateMutex.Unlock()
+
+	for chcfname, invite := range invites {
+		channel := client.server.channels.Get(chcfname)
+		if channel != nil && channel.Ctime().Equal(invite.channelCreatedAt) {
+			result = append(result, channel.Name())
+		}
+	}
+	sort.Strings(result)
+	return
+}
+
 // Checks that the client was invited to join a given channel
 func (client *Client) CheckInvited(casefoldedChannel string, createdTime time.Time) (invited bool) {
 	config := client.server.Config()
@@ -1626,6 +1766,17 @@ func (client *Client) checkLoginThrottle() (throttled bool, remainingTime time.D
 	return client.loginThrottle.Touch()
 }
 
+// checkReportThrottle records a REPORT by the client, returning whether it
+// exceeds the configured limit
+func (client *Client) checkReportThrottle(config *Config) (throttled bool, remainingTime time.Duration) {
+	client.stateMutex.Lock()
+	defer client.stateMutex.Unlock()
+	// take the limits from the current config, in case it was rehashed
+	client.reportThrottle.Duration = config.Server.Reports.Throttling.Duration
+	client.reportThrottle.Limit = config.Server.Reports.Throttling.MaxAttempts
+	return client.reportThrottle.Touch()
+}
+
 func (client *Client) historyStatus(config *Config) (status HistoryStatus, target string) {
 	if !config.History.Enabled {
 		return HistoryDisabled, ""
@@ -1720,7 +1871,7 @@ func (client *Client) privmsgsBetween(startTime, endTime time.Time, targetLimit,
 		return
 	}
 	for _, target := range targets {
-		if strings.HasPrefix(target.CfName, "#") {
+		if isChannelName(target.CfName) {
 			continue
 		}
 		_, seq, err := client.server.GetHistorySequence(nil, client, target.CfName)
@@ -1736,8 +1887,8 @@ func (client *Client) privmsgsBetween(startTime, endTime time.Time, targetLimit,
 	return
 }
 
-func (client *Client) handleRegisterTimeout() {
-	client.Quit(fmt.Sprintf("Registration timeout: %v", RegisterTimeout), nil)
+func (client *Client) handleRegisterTimeout(timeout time.Duration) {
+	client.Quit(fmt.Sprintf("Registration timeout: did not complete registration within %v", timeout), nil)
 	client.destroy(nil)
 }
 
@@ -1768,15 +1919,30 @@ func (client *Client) markDirty(dirtyBits uint) {
 
 func (client *Client) wakeWriter() {
 	if client.writebackLock.TryLock() {
+		if client.writeback.retrying {
+			// the waiting write loop will pick up the new dirty bits
+			client.writebackLock.Unlock()
+			return
+		}
 		go client.writeLoop()
 	}
 }
 
 func (client *Client) writeLoop() {
 	for {
-		client.performWrite(0)
+		err := client.performWrite(0)
+		delay := client.server.writebackResult(client.Nick(), &client.writeback, err)
+		client.writeback.retrying = delay != 0
 		client.writebackLock.Unlock()
 
+		if delay != 0 {
+			// the dirty bits were restored, so we'll try again after the delay
+			time.Sleep(delay)
+			client.writebackLock.Lock()
+			client.writeback.retrying = false
+			continue
+		}
+
 		client.stateMutex.RLock()
 		isDirty := client.dirtyBits != 0
 		client.stateMutex.RUnlock()
@@ -1787,7 +1953,7 @@ func (client *Client) writeLoop() {
 	}
 }
 
-func (client *Client) performWrite(additionalDirtyBits uint) {
+func (client *Client) performWrite(additionalDirtyBits uint) (err error) {
 	client.stateMutex.Lock()
 	dirtyBits := client.dirtyBits | additionalDirtyBits
 	client.dirtyBits = 0
@@ -1799,14 +1965,20 @@ func (client *Client) performWrite(additionalDirtyBits uint) {
 		return
 	}
 
+	var failedBits uint
+
 	if (dirtyBits & IncludeChannels) != 0 {
 		channels := client.Channels()
 		channelToModes := make(map[string]alwaysOnChannelStatus, len(channels))
 		for _, channel := range channels {
 			chname, status := channel.alwaysOnStatus(client)
-			channelToModes[chname] = status
+			if !isLocalChannelName(chname) {
+				channelToModes[chname] = status
+			}
+		}
+		if err = client.server.accounts.saveChannels(account, channelToModes); err != nil {
+			failedBits |= IncludeChannels
 		}
-		client.server.accounts.saveChannels(account, channelToModes)
 	}
 	if (dirtyBits & IncludeUserModes) != 0 {
 		uModes := make(modes.Modes, 0, len(modes.SupportedUserModes))
@@ -1820,11 +1992,25 @@ func (client *Client) performWrite(additionalDirtyBits uint) {
 				}
 			}
 		}
-		client.server.accounts.saveModes(account, uModes)
+		if saveErr := client.server.accounts.saveModes(account, uModes); saveErr != nil {
+			err = saveErr
+			failedBits |= IncludeUserModes
+		}
 	}
 	if (dirtyBits & IncludeRealname) != 0 {
-		client.server.accounts.saveRealname(account, client.realname)
+		if saveErr := client.server.accounts.saveRealname(account, client.realname); saveErr != nil {
+			err = saveErr
+			failedBits |= IncludeRealname
+		}
 	}
+
+	if failedBits != 0 {
+		// restore the bits we failed to write so they'll be retried
+		client.stateMutex.Lock()
+		client.dirtyBits |= failedBits
+		client.stateMutex.Unlock()
+	}
+	return
 }
 
 // Blocking store; see Channel.Store and Socket.BlockingWrite
@@ -1841,6 +2027,7 @@ func (client *Client) Store(dirtyBits uint) (err error) {
 
 	client.writebackLock.Lock()
 	defer client.writebackLock.Unlock()
-	client.performWrite(dirtyBits)
-	return nil
+	err = client.performWrite(dirtyBits)
+	client.server.writebackResult(client.Nick(), &client.writeback, err)
+	return
 }
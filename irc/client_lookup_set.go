@@ -7,6 +7,7 @@ package irc
 import (
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/ergochat/ergo/irc/caps"
 	"github.com/ergochat/ergo/irc/modes"
@@ -18,12 +19,15 @@ type ClientManager struct {
 	sync.RWMutex // tier 2
 	byNick       map[string]*Client
 	bySkeleton   map[string]*Client
+	// casefolded nicks of killed clients -> their temporary reservations
+	delayedNicks map[string]delayedNick
 }
 
 // Initialize initializes a ClientManager.
 func (clients *ClientManager) Initialize() {
 	clients.byNick = make(map[string]*Client)
 	clients.bySkeleton = make(map[string]*Client)
+	clients.delayedNicks = make(map[string]delayedNick)
 }
 
 // Get retrieves a client from the manager, if they exist.
@@ -38,6 +42,56 @@ func (clients *ClientManager) Get(nick string) *Client {
 	return nil
 }
 
+// delayedNick is a temporary reservation of a killed client's nickname
+type delayedNick struct {
+	account    string // casefolded account exempt from the reservation, if any
+	expiration time.Time
+}
+
+// DelayNick reserves a killed client's nickname for `duration`, so that
+// it can't be reclaimed by anyone other than its owning account: the account
+// that registered the nickname, or else the account the client was logged into.
+func (clients *ClientManager) DelayNick(client *Client, duration time.Duration) {
+	if duration <= 0 {
+		return
+	}
+	cfnick, _ := client.uniqueIdentifiers()
+	if cfnick == "*" || cfnick == "" {
+		return
+	}
+	account := client.server.accounts.NickToAccount(cfnick)
+	if account == "" {
+		account = client.Account()
+	}
+	now := time.Now().UTC()
+
+	clients.Lock()
+	defer clients.Unlock()
+
+	// opportunistically clean up expired reservations
+	for nick, delay := range clients.delayedNicks {
+		if !now.Before(delay.expiration) {
+			delete(clients.delayedNicks, nick)
+		}
+	}
+	clients.delayedNicks[cfnick] = delayedNick{account: account, expiration: now.Add(duration)}
+}
+
+// nickDelayedInternal returns whether `cfnick` is reserved by DelayNick
+// against `account` (the casefolded account of the client claiming it).
+// requires holding the writable Lock()
+func (clients *ClientManager) nickDelayedInternal(cfnick, account string, now time.Time) bool {
+	delay, ok := clients.delayedNicks[cfnick]
+	if !ok {
+		return false
+	}
+	if !now.Before(delay.expiration) {
+		delete(clients.delayedNicks, cfnick)
+		return false
+	}
+	return delay.account == "" || delay.account != account
+}
+
 func (clients *ClientManager) removeInternal(client *Client, oldcfnick, oldskeleton string) (err error) {
 	// requires holding the writable Lock()
 	if oldcfnick == "*" || oldcfnick == "" {
@@ -187,6 +241,10 @@ func (clients *ClientManager) SetNick(client *Client, session *Session, newNick
 	clients.Lock()
 	defer clients.Unlock()
 
+	if clients.nickDelayedInternal(newCfNick, account, time.Now().UTC()) {
+		return "", errNicknameDelayed, false
+	}
+
 	currentClient := clients.byNick[newCfNick]
 	// the client may just be changing case
 	if currentClient != nil && currentClient != client {
@@ -246,6 +304,19 @@ func (clients *ClientManager) AllClients() (result []*Client) {
 	return
 }
 
+// Filter returns all clients for which the predicate returns true.
+// The predicate is called while holding the read lock.
+func (clients *ClientManager) Filter(predicate func(*Client) bool) (result []*Client) {
+	clients.RLock()
+	defer clients.RUnlock()
+	for _, client := range clients.byNick {
+		if predicate(client) {
+			result = append(result, client)
+		}
+	}
+	return
+}
+
 // AllWithCapsNotify returns all clients with the given capabilities, and that support cap-notify.
 func (clients *ClientManager) AllWithCapsNotify(capabs ...caps.Capability) (sessions []*Session) {
 	capabs = append(capabs, caps.CapNotify)
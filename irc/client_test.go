@@ -6,6 +6,7 @@ package irc
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/ergochat/ergo/irc/languages"
 	"github.com/ergochat/ergo/irc/utils"
@@ -131,3 +132,21 @@ func TestWhoFields(t *testing.T) {
 		t.Error("failed to set and get")
 	}
 }
+
+func TestNickDelayed(t *testing.T) {
+	var clients ClientManager
+	clients.Initialize()
+	now := time.Now().UTC()
+	clients.delayedNicks["alice"] = delayedNick{account: "alice", expiration: now.Add(time.Minute)}
+	clients.delayedNicks["bob"] = delayedNick{expiration: now.Add(time.Minute)}
+
+	// only the owning account can reclaim the nickname
+	assertEqual(clients.nickDelayedInternal("alice", "alice", now), false)
+	assertEqual(clients.nickDelayedInternal("alice", "mallory", now), true)
+	assertEqual(clients.nickDelayedInternal("alice", "", now), true)
+	assertEqual(clients.nickDelayedInternal("bob", "bob", now), true)
+	assertEqual(clients.nickDelayedInternal("bob", "", now), true)
+	// reservations expire
+	assertEqual(clients.nickDelayedInternal("alice", "mallory", now.Add(time.Hour)), false)
+	assertEqual(clients.nickDelayedInternal("bob", "", now.Add(time.Hour)), false)
+}
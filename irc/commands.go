@@ -83,6 +83,11 @@ func init() {
 			handler:   sceneHandler,
 			minParams: 2,
 		},
+		"APITOKEN": {
+			handler:   apitokenHandler,
+			minParams: 1,
+			capabs:    []string{"rehash"},
+		},
 		"AUTHENTICATE": {
 			handler:      authenticateHandler,
 			usablePreReg: true,
@@ -107,6 +112,11 @@ func init() {
 			handler:   chathistoryHandler,
 			minParams: 4,
 		},
+		"CONNEXEMPT": {
+			handler:   connexemptHandler,
+			minParams: 1,
+			capabs:    []string{"ban"},
+		},
 		"DEBUG": {
 			handler:   debugHandler,
 			minParams: 1,
@@ -120,6 +130,10 @@ func init() {
 			handler:   deoperHandler,
 			minParams: 0,
 		},
+		"DIE": {
+			handler: dieHandler,
+			capabs:  []string{"die"},
+		},
 		"DLINE": {
 			handler:   dlineHandler,
 			minParams: 1,
@@ -129,6 +143,11 @@ func init() {
 			handler:   extjwtHandler,
 			minParams: 1,
 		},
+		"GLOBOPS": {
+			handler:   globopsHandler,
+			minParams: 1,
+			capabs:    []string{"wallops"},
+		},
 		"HELP": {
 			handler:   helpHandler,
 			minParams: 0,
@@ -146,7 +165,7 @@ func init() {
 		},
 		"INVITE": {
 			handler:   inviteHandler,
-			minParams: 2,
+			minParams: 0,
 		},
 		"ISON": {
 			handler:   isonHandler,
@@ -179,6 +198,15 @@ func init() {
 			handler:   listHandler,
 			minParams: 0,
 		},
+		"LISTENER": {
+			handler:   listenerHandler,
+			minParams: 2,
+			capabs:    []string{"rehash"},
+		},
+		"LOADSTATUS": {
+			handler: loadstatusHandler,
+			capabs:  []string{"rehash"},
+		},
 		"LUSERS": {
 			handler:   lusersHandler,
 			minParams: 0,
@@ -225,6 +253,15 @@ func init() {
 			handler:   operHandler,
 			minParams: 1,
 		},
+		"OPERTOTP": {
+			handler:   opertotpHandler,
+			minParams: 1,
+		},
+		"OPERWALL": {
+			handler:   globopsHandler,
+			minParams: 1,
+			capabs:    []string{"wallops"},
+		},
 		"PART": {
 			handler:   partHandler,
 			minParams: 1,
@@ -266,6 +303,10 @@ func init() {
 			handler:   renameHandler,
 			minParams: 2,
 		},
+		"REPORT": {
+			handler:   reportHandler,
+			minParams: 2,
+		},
 		"SAJOIN": {
 			handler:   sajoinHandler,
 			minParams: 1,
@@ -289,6 +330,14 @@ func init() {
 			handler:   setnameHandler,
 			minParams: 1,
 		},
+		"STAFF": {
+			handler: staffHandler,
+		},
+		"STATS": {
+			handler:   statsHandler,
+			minParams: 1,
+			capabs:    []string{"ban"},
+		},
 		"SUMMON": {
 			handler: summonHandler,
 		},
@@ -310,6 +359,10 @@ func init() {
 			minParams: 0,
 			capabs:    []string{"rehash"},
 		},
+		"RESTART": {
+			handler: restartHandler,
+			capabs:  []string{"die"},
+		},
 		"TIME": {
 			handler:   timeHandler,
 			minParams: 0,
@@ -358,6 +411,11 @@ func init() {
 			handler:   versionHandler,
 			minParams: 0,
 		},
+		"WALLOPS": {
+			handler:   wallopsHandler,
+			minParams: 1,
+			capabs:    []string{"wallops"},
+		},
 		"WEBIRC": {
 			handler:      webircHandler,
 			usablePreReg: true,
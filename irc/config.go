@@ -25,6 +25,7 @@ import (
 
 	"code.cloudfoundry.org/bytefmt"
 	"github.com/ergochat/irc-go/ircfmt"
+	"golang.org/x/crypto/bcrypt"
 	"gopkg.in/yaml.v2"
 
 	"github.com/ergochat/ergo/irc/caps"
@@ -35,6 +36,7 @@ import (
 	"github.com/ergochat/ergo/irc/isupport"
 	"github.com/ergochat/ergo/irc/jwt"
 	"github.com/ergochat/ergo/irc/languages"
+	"github.com/ergochat/ergo/irc/linkpreview"
 	"github.com/ergochat/ergo/irc/logger"
 	"github.com/ergochat/ergo/irc/modes"
 	"github.com/ergochat/ergo/irc/mysql"
@@ -66,6 +68,16 @@ type listenerConfigBlock struct {
 	STSOnly         bool `yaml:"sts-only"`
 	WebSocket       bool
 	HideSTS         bool `yaml:"hide-sts"`
+	RequireSASL     bool `yaml:"require-sasl"`
+	Keepalive       utils.KeepaliveOverrides
+	// for bot fleets: skip LUSERS and MOTD during registration
+	QuietRegistration bool `yaml:"quiet-registration"`
+	// alternate MOTD for clients of this listener
+	MOTD string
+	// for private (e.g., staff-only) ports: reject TLS clients that don't
+	// present a certificate, or, if ClientCA is set, one signed by that CA
+	RequireClientCert bool   `yaml:"require-client-cert"`
+	ClientCA          string `yaml:"client-ca"`
 }
 
 type HistoryCutoff uint
@@ -283,6 +295,21 @@ type throttleConfig struct {
 	MaxAttempts int `yaml:"max-attempts"`
 }
 
+// KeepaliveConfig controls how the server detects dead connections.
+type KeepaliveConfig struct {
+	// how long a new connection has to complete registration:
+	RegistrationTimeout time.Duration `yaml:"registration-timeout"`
+	// how long a connection can be idle before we send it a PING:
+	PingInterval    time.Duration `yaml:"ping-interval"`
+	TorPingInterval time.Duration `yaml:"tor-ping-interval"`
+	// how long to wait for a reply to each PING:
+	PingTimeout time.Duration `yaml:"ping-timeout"`
+	// how many unanswered PINGs to send before disconnecting:
+	MaxMissedPings int `yaml:"max-missed-pings"`
+	// if true, only PONG counts as a reply to our PING; otherwise any traffic does:
+	RequirePong bool `yaml:"require-pong"`
+}
+
 type ThrottleConfig struct {
 	throttleConfig
 }
@@ -308,7 +335,13 @@ type AccountConfig struct {
 		Enabled      bool
 		Exempted     []string
 		exemptedNets []net.IPNet
+		Networks     []string
+		networks     []net.IPNet
 	} `yaml:"require-sasl"`
+	RequireTLS struct {
+		Accounts       []string
+		accountMatcher *regexp.Regexp
+	} `yaml:"require-tls"`
 	DefaultUserModes    *string `yaml:"default-user-modes"`
 	defaultUserModes    modes.Modes
 	LoginThrottling     ThrottleConfig `yaml:"login-throttling"`
@@ -332,6 +365,10 @@ type AccountConfig struct {
 	Bouncer     *MulticlientConfig // # handle old name for 'multiclient'
 	VHosts      VHostConfig
 	AuthScript  AuthScriptConfig `yaml:"auth-script"`
+	TOTP        struct {
+		Enabled bool
+	}
+	LoginLockout connection_limits.LockoutConfig `yaml:"login-lockout"`
 }
 
 type ScriptConfig struct {
@@ -450,6 +487,8 @@ func (cm *Casemapping) UnmarshalYAML(unmarshal func(interface{}) error) (err err
 		result = CasemappingPRECIS
 	case "permissive", "fun":
 		result = CasemappingPermissive
+	case "rfc1459":
+		result = CasemappingRFC1459
 	default:
 		return fmt.Errorf("invalid casemapping value: %s", orig)
 	}
@@ -463,6 +502,7 @@ type OperClassConfig struct {
 	WhoisLine    string
 	Extends      string
 	Capabilities []string
+	ActionLimit  ThrottleConfig `yaml:"action-limit"`
 }
 
 // OperConfig defines a specific operator's configuration.
@@ -476,20 +516,23 @@ type OperConfig struct {
 	Auto        bool
 	Hidden      bool
 	Modes       string
+	Staff       bool
 }
 
 // Various server-enforced limits on data size.
 type Limits struct {
-	AwayLen              int `yaml:"awaylen"`
-	ChanListModes        int `yaml:"chan-list-modes"`
-	ChannelLen           int `yaml:"channellen"`
-	IdentLen             int `yaml:"identlen"`
-	KickLen              int `yaml:"kicklen"`
-	MonitorEntries       int `yaml:"monitor-entries"`
-	NickLen              int `yaml:"nicklen"`
-	TopicLen             int `yaml:"topiclen"`
-	WhowasEntries        int `yaml:"whowas-entries"`
-	RegistrationMessages int `yaml:"registration-messages"`
+	AwayLen              int              `yaml:"awaylen"`
+	ChanListModes        int              `yaml:"chan-list-modes"`
+	ChannelLen           int              `yaml:"channellen"`
+	IdentLen             int              `yaml:"identlen"`
+	KickLen              int              `yaml:"kicklen"`
+	MonitorEntries       int              `yaml:"monitor-entries"`
+	NickLen              int              `yaml:"nicklen"`
+	TopicLen             int              `yaml:"topiclen"`
+	WhowasEntries        int              `yaml:"whowas-entries"`
+	WhowasMaxAge         custime.Duration `yaml:"whowas-max-age"`
+	WhoisChannels        int              `yaml:"whois-channels"`
+	RegistrationMessages int              `yaml:"registration-messages"`
 	Multiline            struct {
 		MaxBytes int `yaml:"max-bytes"`
 		MaxLines int `yaml:"max-lines"`
@@ -524,6 +567,7 @@ type FakelagConfig struct {
 	BurstLimit        uint `yaml:"burst-limit"`
 	MessagesPerWindow uint `yaml:"messages-per-window"`
 	Cooldown          time.Duration
+	MaxLag            time.Duration  `yaml:"max-lag"`
 	CommandBudgets    map[string]int `yaml:"command-budgets"`
 }
 
@@ -539,6 +583,8 @@ type TorListenersConfig struct {
 // Config defines the overall configuration.
 type Config struct {
 	AllowEnvironmentOverrides bool `yaml:"allow-environment-overrides"`
+	StrictConfig              bool `yaml:"strict-config"`
+	Profile                   string
 
 	Network struct {
 		Name string
@@ -561,12 +607,16 @@ type Config struct {
 		STS                     STSConfig
 		LookupHostnames         *bool `yaml:"lookup-hostnames"`
 		lookupHostnames         bool
-		ForwardConfirmHostnames bool   `yaml:"forward-confirm-hostnames"`
-		CheckIdent              bool   `yaml:"check-ident"`
-		CoerceIdent             string `yaml:"coerce-ident"`
+		ForwardConfirmHostnames bool          `yaml:"forward-confirm-hostnames"`
+		HostnameLookupTimeout   time.Duration `yaml:"hostname-lookup-timeout"`
+		CheckIdent              bool          `yaml:"check-ident"`
+		CoerceIdent             string        `yaml:"coerce-ident"`
 		MOTD                    string
 		motdLines               []string
-		MOTDFormatting          bool `yaml:"motd-formatting"`
+		MOTDFormatting          bool              `yaml:"motd-formatting"`
+		SNIMOTDs                map[string]string `yaml:"sni-motds"`
+		sniMOTDLines            map[string][]string
+		listenerMOTDLines       map[string][]string // keyed by file path
 		Relaymsg                struct {
 			Enabled            bool
 			Separators         string
@@ -577,7 +627,12 @@ type Config struct {
 		WebIRC               []webircConfig `yaml:"webirc"`
 		MaxSendQString       string         `yaml:"max-sendq"`
 		MaxSendQBytes        int
-		Compatibility        struct {
+		ClientLimit          struct {
+			MaxClients     int  `yaml:"max-clients"`
+			WarningPercent int  `yaml:"warning-percent"`
+			ExemptSASL     bool `yaml:"exempt-sasl"`
+		} `yaml:"client-limit"`
+		Compatibility struct {
 			ForceTrailing      *bool `yaml:"force-trailing"`
 			forceTrailing      bool
 			SendUnprefixedSasl bool  `yaml:"send-unprefixed-sasl"`
@@ -594,11 +649,33 @@ type Config struct {
 		capValues                caps.Values
 		Casemapping              Casemapping
 		EnforceUtf8              bool                `yaml:"enforce-utf8"`
+		ReplaceInvalidUtf8       bool                `yaml:"replace-invalid-utf8"`
 		OutputPath               string              `yaml:"output-path"`
 		IPCheckScript            IPCheckScriptConfig `yaml:"ip-check-script"`
+		DNSBL                    DNSBLConfig         `yaml:"dnsbl"`
 		OverrideServicesHostname string              `yaml:"override-services-hostname"`
 		MaxLineLen               int                 `yaml:"max-line-len"`
 		SuppressLusers           bool                `yaml:"suppress-lusers"`
+		NotifyOperWhois          bool                `yaml:"notify-oper-whois"`
+		NickDelay                time.Duration       `yaml:"nick-delay"`
+		IdleNotify               time.Duration       `yaml:"idle-notify"`
+		OperExpiration           struct {
+			MaxIdle    time.Duration `yaml:"max-idle"`
+			OnReattach bool          `yaml:"on-reattach"`
+		} `yaml:"oper-expiration"`
+		Reports struct {
+			Enabled      bool
+			Channel      string
+			HistoryLines int `yaml:"history-lines"`
+			Throttling   ThrottleConfig
+		}
+		DCC struct {
+			BlockSend         bool     `yaml:"block-send"`
+			BlockedExtensions []string `yaml:"blocked-extensions"`
+			RequireAccount    bool     `yaml:"require-account"`
+		}
+		LinkPreviews linkpreview.Config `yaml:"link-previews"`
+		Keepalive    KeepaliveConfig
 	}
 
 	Roleplay struct {
@@ -623,10 +700,12 @@ type Config struct {
 	languageManager *languages.Manager
 
 	LockFile string `yaml:"lock-file"`
+	PidFile  string `yaml:"pid-file"`
 
 	Datastore struct {
 		Path        string
 		AutoUpgrade bool
+		Sync        string
 		MySQL       mysql.Config
 	}
 
@@ -645,6 +724,8 @@ type Config struct {
 		ListDelay        time.Duration    `yaml:"list-delay"`
 		InviteExpiration custime.Duration `yaml:"invite-expiration"`
 		AutoJoin         []string         `yaml:"auto-join"`
+		// user mode +J hides presence changes in channels at least this large
+		SmartFilterThreshold int `yaml:"smart-filter-threshold"`
 	}
 
 	OperClasses map[string]*OperClassConfig `yaml:"oper-classes"`
@@ -654,9 +735,13 @@ type Config struct {
 	// parsed operator definitions, unexported so they can't be defined
 	// directly in YAML:
 	operators map[string]*Oper
+	// the bcrypt cost of most operator password hashes, see passwd.CheckMissingConfigPassword
+	operPassCost int
 
 	Logging []logger.LoggingConfig
 
+	API APIConfig
+
 	Debug struct {
 		RecoverFromErrors *bool `yaml:"recover-from-errors"`
 		recoverFromErrors bool
@@ -708,6 +793,7 @@ type OperClass struct {
 	Title        string
 	WhoisLine    string                `yaml:"whois-line"`
 	Capabilities utils.HashSet[string] // map to make lookups much easier
+	ActionLimit  ThrottleConfig
 }
 
 // OperatorClasses returns a map of assembled operator classes from the given config.
@@ -754,6 +840,7 @@ func (conf *Config) OperatorClasses() (map[string]*OperClass, error) {
 				for capab := range einfo.Capabilities {
 					oc.Capabilities.Add(fixupCapability(capab))
 				}
+				oc.ActionLimit = einfo.ActionLimit
 			}
 
 			// add our own info
@@ -764,6 +851,9 @@ func (conf *Config) OperatorClasses() (map[string]*OperClass, error) {
 			for _, capab := range info.Capabilities {
 				oc.Capabilities.Add(fixupCapability(capab))
 			}
+			if info.ActionLimit.Enabled {
+				oc.ActionLimit = info.ActionLimit
+			}
 			if len(info.WhoisLine) > 0 {
 				oc.WhoisLine = info.WhoisLine
 			} else {
@@ -791,6 +881,7 @@ func (conf *Config) OperatorClasses() (map[string]*OperClass, error) {
 type Oper struct {
 	Name      string
 	Class     *OperClass
+	ClassName string
 	WhoisLine string
 	Vhost     string
 	Pass      []byte
@@ -798,6 +889,7 @@ type Oper struct {
 	Auto      bool
 	Hidden    bool
 	Modes     []modes.ModeChange
+	Staff     bool
 }
 
 func (oper *Oper) HasRoleCapab(capab string) bool {
@@ -835,6 +927,7 @@ func (conf *Config) Operators(oc map[string]*OperClass) (map[string]*Oper, error
 		}
 		oper.Auto = opConf.Auto
 		oper.Hidden = opConf.Hidden
+		oper.Staff = opConf.Staff
 
 		if oper.Pass == nil && oper.Certfp == "" {
 			return nil, fmt.Errorf("Oper %s has neither a password nor a fingerprint", name)
@@ -849,6 +942,7 @@ func (conf *Config) Operators(oc map[string]*OperClass) (map[string]*Oper, error
 			return nil, fmt.Errorf("Could not load operator [%s] - they use operclass [%s] which does not exist", name, opConf.Class)
 		}
 		oper.Class = class
+		oper.ClassName = opConf.Class
 		if len(opConf.WhoisLine) > 0 {
 			oper.WhoisLine = opConf.WhoisLine
 		} else {
@@ -897,9 +991,24 @@ func loadTlsConfig(config listenerConfigBlock) (tlsConfig *tls.Config, err error
 		// work around this behavior:
 		clientAuth = tls.NoClientCert
 	}
+	var clientCAs *x509.CertPool
+	if config.ClientCA != "" {
+		caPEM, err := os.ReadFile(config.ClientCA)
+		if err != nil {
+			return nil, err
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in client-ca file %s", config.ClientCA)
+		}
+		clientAuth = tls.RequireAndVerifyClientCert
+	} else if config.RequireClientCert {
+		clientAuth = tls.RequireAnyClientCert
+	}
 	result := tls.Config{
 		Certificates: certificates,
 		ClientAuth:   clientAuth,
+		ClientCAs:    clientCAs,
 		MinVersion:   tlsMinVersionFromString(config.MinTLSVersion),
 	}
 	return &result, nil
@@ -956,12 +1065,19 @@ func (conf *Config) prepareListeners() (err error) {
 		if err != nil {
 			return &CertKeyError{Err: err}
 		}
+		if lconf.TLSConfig == nil && (block.RequireClientCert || block.ClientCA != "") {
+			return fmt.Errorf("%s requires client certificates, but is not a TLS listener", addr)
+		}
 		lconf.RequireProxy = block.TLS.Proxy || block.Proxy
 		lconf.WebSocket = block.WebSocket
 		if lconf.WebSocket && !conf.Server.EnforceUtf8 {
 			return fmt.Errorf("enabling a websocket listener requires the use of server.enforce-utf8")
 		}
 		lconf.HideSTS = block.HideSTS
+		lconf.RequireSASL = block.RequireSASL
+		lconf.Keepalive = block.Keepalive
+		lconf.Quiet = block.QuietRegistration
+		lconf.MOTD = block.MOTD
 		conf.Server.trueListeners[addr] = lconf
 	}
 	return nil
@@ -1004,6 +1120,30 @@ func LoadRawConfig(filename string) (config *Config, err error) {
 	return
 }
 
+// checkUnknownConfigKeys re-parses the config file strictly, returning an
+// error describing any keys that don't correspond to a config field
+func checkUnknownConfigKeys(filename string) (err error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	var config Config
+	err = yaml.UnmarshalStrict(data, &config)
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		// the default message includes the full (unreadable) type of each
+		// anonymous struct; report only the locations and names of the keys
+		unknown := make([]string, len(typeErr.Errors))
+		for i, e := range typeErr.Errors {
+			if before, _, found := strings.Cut(e, " not found in type "); found {
+				e = before
+			}
+			unknown[i] = e
+		}
+		err = fmt.Errorf("unknown config keys: %s", strings.Join(unknown, "; "))
+	}
+	return
+}
+
 // convert, e.g., "ALLOWED_ORIGINS" to "allowed-origins"
 func screamingSnakeToKebab(in string) (out string) {
 	var buf strings.Builder
@@ -1113,6 +1253,13 @@ func LoadConfig(filename string) (config *Config, err error) {
 		return nil, err
 	}
 
+	if err = checkUnknownConfigKeys(filename); err != nil {
+		if config.StrictConfig {
+			return nil, err
+		}
+		log.Printf("warning: ignoring %v\n", err)
+	}
+
 	if config.AllowEnvironmentOverrides {
 		for _, envPair := range os.Environ() {
 			applied, envErr := mungeFromEnvironment(config, envPair)
@@ -1128,6 +1275,10 @@ func LoadConfig(filename string) (config *Config, err error) {
 		}
 	}
 
+	if err = config.applyProfile(); err != nil {
+		return nil, err
+	}
+
 	config.Filename = filename
 
 	if config.Network.Name == "" {
@@ -1143,6 +1294,9 @@ func LoadConfig(filename string) (config *Config, err error) {
 	if config.Datastore.Path == "" {
 		return nil, errors.New("Datastore path missing")
 	}
+	if _, err := syncPolicyFromString(config.Datastore.Sync); err != nil {
+		return nil, err
+	}
 	//dan: automagically fix identlen until a few releases in the future (from now, 0.12.0), being a newly-introduced limit
 	if config.Limits.IdentLen < 1 {
 		config.Limits.IdentLen = 20
@@ -1209,6 +1363,12 @@ func LoadConfig(filename string) (config *Config, err error) {
 	config.Server.capValues[caps.STS] = config.Server.STS.Value()
 
 	config.Server.lookupHostnames = utils.BoolDefaultTrue(config.Server.LookupHostnames)
+	if err = config.Server.DNSBL.postprocess(); err != nil {
+		return nil, err
+	}
+	if config.Server.HostnameLookupTimeout <= 0 {
+		config.Server.HostnameLookupTimeout = DefaultHostnameLookupTimeout
+	}
 
 	// process webirc blocks
 	var newWebIRC []webircConfig
@@ -1285,6 +1445,21 @@ func LoadConfig(filename string) (config *Config, err error) {
 		logConfig.MethodFile = methods["file"]
 		logConfig.MethodStdout = methods["stdout"]
 		logConfig.MethodStderr = methods["stderr"]
+		logConfig.MethodSyslog = methods["syslog"]
+		switch strings.ToLower(logConfig.Format) {
+		case "", "text":
+		case "json":
+			logConfig.FormatJSON = true
+		default:
+			return nil, fmt.Errorf("Invalid logging format: %s", logConfig.Format)
+		}
+		if logConfig.MaxSizeString != "" {
+			maxSize, err := bytefmt.ToBytes(logConfig.MaxSizeString)
+			if err != nil {
+				return nil, fmt.Errorf("Could not parse logging max-size: %s", err.Error())
+			}
+			logConfig.MaxSize = int64(maxSize)
+		}
 
 		// levels
 		level, exists := logger.LogLevelNames[strings.ToLower(logConfig.LevelString)]
@@ -1366,6 +1541,25 @@ func LoadConfig(filename string) (config *Config, err error) {
 	if err != nil {
 		return nil, fmt.Errorf("Could not parse require-sasl exempted nets: %v", err.Error())
 	}
+	config.Accounts.RequireSasl.networks, err = utils.ParseNetList(config.Accounts.RequireSasl.Networks)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse require-sasl networks: %v", err.Error())
+	}
+	if len(config.Accounts.RequireTLS.Accounts) != 0 {
+		// account names are matched in casefolded form, using the server casemapping
+		// (these are globs, which CasefoldName would reject)
+		accounts := make([]string, len(config.Accounts.RequireTLS.Accounts))
+		for i, account := range config.Accounts.RequireTLS.Accounts {
+			accounts[i], err = Casefold(account)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid require-tls account %s: %v", account, err)
+			}
+		}
+		config.Accounts.RequireTLS.accountMatcher, err = utils.CompileMasks(accounts)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse require-tls accounts: %v", err.Error())
+		}
+	}
 
 	config.Server.proxyAllowedFromNets, err = utils.ParseNetList(config.Server.ProxyAllowedFrom)
 	if err != nil {
@@ -1423,6 +1617,15 @@ func LoadConfig(filename string) (config *Config, err error) {
 	}
 	config.Server.MaxSendQBytes = int(maxSendQBytes)
 
+	if config.API.Enabled {
+		if config.API.Listener == "" {
+			return nil, errors.New("API is enabled but no listener address was specified")
+		}
+		if config.API.CacheDuration == 0 {
+			config.API.CacheDuration = time.Minute
+		}
+	}
+
 	config.languageManager, err = languages.NewManager(config.Languages.Enabled, config.Languages.Path, config.Languages.Default)
 	if err != nil {
 		return nil, fmt.Errorf("Could not load languages: %s", err.Error())
@@ -1451,6 +1654,10 @@ func LoadConfig(filename string) (config *Config, err error) {
 		config.Server.supportedCaps.Disable(caps.Relaymsg)
 	}
 
+	if config.Server.IdleNotify <= 0 {
+		config.Server.supportedCaps.Disable(caps.IdleNotify)
+	}
+
 	config.Debug.recoverFromErrors = utils.BoolDefaultTrue(config.Debug.RecoverFromErrors)
 
 	// process operator definitions, store them to config.operators
@@ -1463,6 +1670,7 @@ func LoadConfig(filename string) (config *Config, err error) {
 		return nil, err
 	}
 	config.operators = opers
+	config.operPassCost = commonBcryptCost(opers)
 
 	// parse default channel modes
 	config.Channels.defaultModes = ParseDefaultChannelModes(config.Channels.DefaultModes)
@@ -1471,6 +1679,46 @@ func LoadConfig(filename string) (config *Config, err error) {
 		config.Accounts.Registration.BcryptCost = passwd.DefaultCost
 	}
 
+	keepalive := &config.Server.Keepalive
+	if keepalive.RegistrationTimeout == 0 {
+		keepalive.RegistrationTimeout = RegisterTimeout
+	}
+	if keepalive.PingInterval == 0 {
+		keepalive.PingInterval = DefaultIdleTimeout
+	}
+	if keepalive.TorPingInterval == 0 {
+		keepalive.TorPingInterval = TorIdleTimeout
+	}
+	if keepalive.PingTimeout == 0 {
+		keepalive.PingTimeout = DefaultTotalTimeout - DefaultIdleTimeout
+	}
+	if keepalive.MaxMissedPings == 0 {
+		keepalive.MaxMissedPings = 1
+	}
+
+	if config.Accounts.LoginLockout.Enabled {
+		lockout := &config.Accounts.LoginLockout
+		if lockout.Attempts == 0 {
+			lockout.Attempts = 10
+		}
+		if lockout.Duration == 0 {
+			lockout.Duration = time.Minute
+		}
+		if lockout.MaxDuration < lockout.Duration {
+			lockout.MaxDuration = time.Hour
+			if lockout.MaxDuration < lockout.Duration {
+				lockout.MaxDuration = lockout.Duration
+			}
+		}
+	}
+
+	if reportThrottling := &config.Server.Reports.Throttling; reportThrottling.Duration == 0 {
+		// omitted entirely: reports should never be unthrottled by default
+		reportThrottling.Enabled = true
+		reportThrottling.Duration = 10 * time.Minute
+		reportThrottling.MaxAttempts = 3
+	}
+
 	if config.Channels.MaxChannelsPerClient == 0 {
 		config.Channels.MaxChannelsPerClient = 100
 	}
@@ -1481,7 +1729,10 @@ func LoadConfig(filename string) (config *Config, err error) {
 	config.Server.Compatibility.forceTrailing = utils.BoolDefaultTrue(config.Server.Compatibility.ForceTrailing)
 	config.Server.Compatibility.allowTruncation = utils.BoolDefaultTrue(config.Server.Compatibility.AllowTruncation)
 
-	config.loadMOTD()
+	err = config.loadMOTD()
+	if err != nil {
+		return nil, err
+	}
 
 	// in the current implementation, we disable history by creating a history buffer
 	// with zero capacity. but the `enabled` config option MUST be respected regardless
@@ -1559,6 +1810,21 @@ func LoadConfig(filename string) (config *Config, err error) {
 	return config, nil
 }
 
+// commonBcryptCost returns the most common cost among the operators' password hashes
+func commonBcryptCost(opers map[string]*Oper) (result int) {
+	counts := make(map[int]int)
+	result = bcrypt.DefaultCost
+	for _, oper := range opers {
+		if cost, err := bcrypt.Cost(oper.Pass); err == nil {
+			counts[cost]++
+			if counts[cost] > counts[result] || (counts[cost] == counts[result] && cost > result) {
+				result = cost
+			}
+		}
+	}
+	return
+}
+
 func (config *Config) getOutputPath(filename string) string {
 	return filepath.Join(config.Server.OutputPath, filename)
 }
@@ -1585,7 +1851,11 @@ func (config *Config) generateISupport() (err error) {
 	isupport.Initialize()
 	isupport.Add("AWAYLEN", strconv.Itoa(config.Limits.AwayLen))
 	isupport.Add("BOT", "B")
-	isupport.Add("CASEMAPPING", "ascii")
+	if config.Server.Casemapping == CasemappingRFC1459 {
+		isupport.Add("CASEMAPPING", "rfc1459")
+	} else {
+		isupport.Add("CASEMAPPING", "ascii")
+	}
 	isupport.Add("CHANLIMIT", fmt.Sprintf("%s:%d", chanTypes, config.Channels.MaxChannelsPerClient))
 	isupport.Add("CHANMODES", chanmodesToken)
 	if config.History.Enabled && config.History.ChathistoryMax > 0 {
@@ -1595,7 +1865,9 @@ func (config *Config) generateISupport() (err error) {
 	}
 	isupport.Add("CHANNELLEN", strconv.Itoa(config.Limits.ChannelLen))
 	isupport.Add("CHANTYPES", chanTypes)
-	isupport.Add("ELIST", "U")
+	// U is the standard user count condition; L (lang=) and G (category=)
+	// are our own, see /HELP LIST
+	isupport.Add("ELIST", "GLU")
 	isupport.Add("EXCEPTS", "")
 	if config.Extjwt.Default.Enabled() || len(config.Extjwt.Services) != 0 {
 		isupport.Add("EXTJWT", "1")
@@ -1705,33 +1977,66 @@ func compileGuestRegexp(guestFormat string, casemapping Casemapping) (standard,
 	return
 }
 
-func (config *Config) loadMOTD() error {
+func (config *Config) loadMOTD() (err error) {
 	if config.Server.MOTD != "" {
-		file, err := os.Open(config.Server.MOTD)
-		if err != nil {
-			return err
+		config.Server.motdLines, err = readMOTDFile(config.Server.MOTD, config.Server.MOTDFormatting)
+	}
+	// a missing SNI MOTD shouldn't prevent the others from loading
+	if len(config.Server.SNIMOTDs) != 0 {
+		config.Server.sniMOTDLines = make(map[string][]string, len(config.Server.SNIMOTDs))
+		for hostname, path := range config.Server.SNIMOTDs {
+			lines, sniErr := readMOTDFile(path, config.Server.MOTDFormatting)
+			if sniErr != nil {
+				err = sniErr
+				continue
+			}
+			config.Server.sniMOTDLines[strings.ToLower(hostname)] = lines
 		}
-		defer file.Close()
-		contents, err := io.ReadAll(file)
-		if err != nil {
-			return err
+	}
+	for _, block := range config.Server.Listeners {
+		if block.MOTD == "" {
+			continue
+		}
+		if config.Server.listenerMOTDLines == nil {
+			config.Server.listenerMOTDLines = make(map[string][]string)
+		} else if _, ok := config.Server.listenerMOTDLines[block.MOTD]; ok {
+			continue // already loaded for another listener
 		}
+		lines, listenerErr := readMOTDFile(block.MOTD, config.Server.MOTDFormatting)
+		if listenerErr != nil {
+			err = listenerErr
+			continue
+		}
+		config.Server.listenerMOTDLines[block.MOTD] = lines
+	}
+	return err
+}
 
-		lines := bytes.Split(contents, []byte{'\n'})
-		for i, line := range lines {
-			lineToSend := string(bytes.TrimRight(line, "\r\n"))
-			if len(lineToSend) == 0 && i == len(lines)-1 {
-				// if the last line of the MOTD was properly terminated with \n,
-				// there's no need to send a blank line to clients
-				continue
-			}
-			if config.Server.MOTDFormatting {
-				lineToSend = ircfmt.Unescape(lineToSend)
-			}
-			// "- " is the required prefix for MOTD
-			lineToSend = fmt.Sprintf("- %s", lineToSend)
-			config.Server.motdLines = append(config.Server.motdLines, lineToSend)
+func readMOTDFile(path string, formatting bool) (motdLines []string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	contents, err := io.ReadAll(file)
+	if err != nil {
+		return
+	}
+
+	lines := bytes.Split(contents, []byte{'\n'})
+	for i, line := range lines {
+		lineToSend := string(bytes.TrimRight(line, "\r\n"))
+		if len(lineToSend) == 0 && i == len(lines)-1 {
+			// if the last line of the MOTD was properly terminated with \n,
+			// there's no need to send a blank line to clients
+			continue
 		}
+		if formatting {
+			lineToSend = ircfmt.Unescape(lineToSend)
+		}
+		// "- " is the required prefix for MOTD
+		lineToSend = fmt.Sprintf("- %s", lineToSend)
+		motdLines = append(motdLines, lineToSend)
 	}
-	return nil
+	return
 }
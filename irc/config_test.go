@@ -6,6 +6,8 @@ package irc
 import (
 	"reflect"
 	"testing"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestEnvironmentOverrides(t *testing.T) {
@@ -99,3 +101,49 @@ func TestEnvironmentOverrideErrors(t *testing.T) {
 		}
 	}
 }
+
+func TestDeploymentProfiles(t *testing.T) {
+	var config Config
+	config.Accounts.Registration.Enabled = true
+	config.Server.Listeners = map[string]listenerConfigBlock{":6667": {}}
+
+	config.Profile = "Private"
+	if err := config.applyProfile(); err != nil {
+		t.Fatal(err)
+	}
+	if config.Accounts.Registration.Enabled || !config.Accounts.RequireSasl.Enabled || !config.History.Enabled {
+		t.Errorf("private profile not applied: %#v", config.Accounts)
+	}
+
+	config.Profile = "tor-only"
+	if err := config.applyProfile(); err != nil {
+		t.Fatal(err)
+	}
+	if !config.Server.Listeners[":6667"].Tor {
+		t.Errorf("tor-only profile should make every listener a Tor listener")
+	}
+
+	config.Profile = "bogus"
+	if err := config.applyProfile(); err == nil {
+		t.Errorf("unknown profile should be an error")
+	}
+}
+
+func TestCommonBcryptCost(t *testing.T) {
+	hash := func(cost int) []byte {
+		result, err := bcrypt.GenerateFromPassword([]byte("hunter2"), cost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	assertEqual(commonBcryptCost(nil), bcrypt.DefaultCost)
+	opers := map[string]*Oper{
+		"a": {Pass: hash(bcrypt.MinCost)},
+		"b": {Pass: hash(bcrypt.MinCost)},
+		"c": {Pass: hash(bcrypt.MinCost + 1)},
+		"d": {}, // certfp-only
+	}
+	assertEqual(commonBcryptCost(opers), bcrypt.MinCost)
+}
@@ -120,8 +120,33 @@ type Limiter struct {
 
 	// IP/CIDR -> count of clients connected from there:
 	limiter map[limiterKey]int
+	// IP -> number of its connections that were counted in `limiter` when they
+	// were added (exemptions may change while they are connected):
+	counted map[flatip.IP]int
 	// IP/CIDR -> throttle state:
 	throttler map[limiterKey]ThrottleDetails
+	// nets exempted at runtime by operators -> expiration time (zero for none);
+	// unlike the configured exemptions, these are not persisted
+	exemptions map[flatip.IPNet]time.Time
+}
+
+// isExempt checks both the configured and the runtime exemptions;
+// call with the mutex held
+func (cl *Limiter) isExempt(addr flatip.IP) bool {
+	if flatip.IPInNets(addr, cl.config.exemptedNets) {
+		return true
+	}
+	now := time.Now().UTC()
+	for network, expiration := range cl.exemptions {
+		if !expiration.IsZero() && now.After(expiration) {
+			delete(cl.exemptions, network)
+			continue
+		}
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
 }
 
 // addrToKey canonicalizes `addr` to a string key, and returns
@@ -154,7 +179,7 @@ func (cl *Limiter) AddClient(addr flatip.IP) error {
 	defer cl.Unlock()
 
 	// we don't track populations for exempted addresses or nets - this is by design
-	if flatip.IPInNets(addr, cl.config.exemptedNets) {
+	if cl.isExempt(addr) {
 		return nil
 	}
 
@@ -188,6 +213,7 @@ func (cl *Limiter) AddClient(addr flatip.IP) error {
 	// success, record in limiter
 	if cl.config.Count {
 		cl.limiter[addrString] = count
+		cl.counted[addr]++
 	}
 
 	return nil
@@ -198,9 +224,15 @@ func (cl *Limiter) RemoveClient(addr flatip.IP) {
 	cl.Lock()
 	defer cl.Unlock()
 
-	if !cl.config.Count || flatip.IPInNets(addr, cl.config.exemptedNets) {
+	// only uncount connections that AddClient counted
+	if cl.counted[addr] == 0 {
 		return
 	}
+	if cl.counted[addr] == 1 {
+		delete(cl.counted, addr)
+	} else {
+		cl.counted[addr]--
+	}
 
 	addrString, _, _, _ := cl.addrToKey(addr)
 	count := cl.limiter[addrString]
@@ -226,7 +258,7 @@ func (cl *Limiter) Status(addr flatip.IP) (netName string, status LimiterStatus)
 	cl.Lock()
 	defer cl.Unlock()
 
-	if flatip.IPInNets(addr, cl.config.exemptedNets) {
+	if cl.isExempt(addr) {
 		status.Exempt = true
 		return
 	}
@@ -256,7 +288,7 @@ func (cl *Limiter) ResetThrottle(addr flatip.IP) {
 	cl.Lock()
 	defer cl.Unlock()
 
-	if !cl.config.Throttle || flatip.IPInNets(addr, cl.config.exemptedNets) {
+	if !cl.config.Throttle || cl.isExempt(addr) {
 		return
 	}
 
@@ -264,6 +296,44 @@ func (cl *Limiter) ResetThrottle(addr flatip.IP) {
 	delete(cl.throttler, addrString)
 }
 
+// AddExemption exempts a net from the connection limits and throttle until
+// the server restarts, or for `duration` if it is nonzero
+func (cl *Limiter) AddExemption(network flatip.IPNet, duration time.Duration) {
+	cl.Lock()
+	defer cl.Unlock()
+
+	var expiration time.Time
+	if duration != 0 {
+		expiration = time.Now().UTC().Add(duration)
+	}
+	cl.exemptions[network] = expiration
+}
+
+// RemoveExemption removes a runtime exemption, returning whether it existed
+func (cl *Limiter) RemoveExemption(network flatip.IPNet) (found bool) {
+	cl.Lock()
+	defer cl.Unlock()
+
+	_, found = cl.exemptions[network]
+	delete(cl.exemptions, network)
+	return
+}
+
+// Exemptions returns the active runtime exemptions and their expiration times
+func (cl *Limiter) Exemptions() (result map[flatip.IPNet]time.Time) {
+	cl.Lock()
+	defer cl.Unlock()
+
+	now := time.Now().UTC()
+	result = make(map[flatip.IPNet]time.Time, len(cl.exemptions))
+	for network, expiration := range cl.exemptions {
+		if expiration.IsZero() || now.Before(expiration) {
+			result[network] = expiration
+		}
+	}
+	return
+}
+
 // ApplyConfig atomically applies a config update to a connection limit handler
 func (cl *Limiter) ApplyConfig(config *LimiterConfig) {
 	cl.Lock()
@@ -272,9 +342,15 @@ func (cl *Limiter) ApplyConfig(config *LimiterConfig) {
 	if cl.limiter == nil {
 		cl.limiter = make(map[limiterKey]int)
 	}
+	if cl.counted == nil {
+		cl.counted = make(map[flatip.IP]int)
+	}
 	if cl.throttler == nil {
 		cl.throttler = make(map[limiterKey]ThrottleDetails)
 	}
+	if cl.exemptions == nil {
+		cl.exemptions = make(map[flatip.IPNet]time.Time)
+	}
 
 	cl.config = config
 }
@@ -93,3 +93,76 @@ func TestLimits(t *testing.T) {
 		t.Errorf("ip should not be blocked, but %v", err)
 	}
 }
+
+func TestExemptions(t *testing.T) {
+	regularIP := easyParseIP("2607:5301:201:3100::7426")
+	config := baseConfig
+	config.postprocess()
+	var limiter Limiter
+	limiter.ApplyConfig(&config)
+
+	for i := 0; i < 4; i++ {
+		limiter.AddClient(regularIP)
+	}
+	if err := limiter.AddClient(regularIP); err != ErrLimitExceeded {
+		t.Errorf("ip should be blocked, but %v", err)
+	}
+
+	network, err := flatip.ParseToNormalizedNet("2607:5301:201:3100::/64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter.AddExemption(network, 0)
+	if err := limiter.AddClient(regularIP); err != nil {
+		t.Errorf("ip should be exempt, but %v", err)
+	}
+	_, status := limiter.Status(regularIP)
+	assertEqual(status.Exempt, true, t)
+	assertEqual(len(limiter.Exemptions()), 1, t)
+
+	// exemptions survive a rehash
+	limiter.ApplyConfig(&config)
+	assertEqual(limiter.RemoveExemption(network), true, t)
+	if err := limiter.AddClient(regularIP); err != ErrLimitExceeded {
+		t.Errorf("ip should be blocked, but %v", err)
+	}
+
+	// expired exemptions are ignored
+	limiter.AddExemption(network, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if err := limiter.AddClient(regularIP); err != ErrLimitExceeded {
+		t.Errorf("ip should be blocked, but %v", err)
+	}
+	assertEqual(len(limiter.Exemptions()), 0, t)
+}
+
+func TestExemptionChangesWhileConnected(t *testing.T) {
+	regularIP := easyParseIP("2607:5301:201:3100::7426")
+	config := baseConfig
+	config.postprocess()
+	var limiter Limiter
+	limiter.ApplyConfig(&config)
+	network, err := flatip.ParseToNormalizedNet("2607:5301:201:3100::/64")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// connected while exempt, then the exemption is removed:
+	// disconnecting must not uncount a connection that was never counted
+	limiter.AddExemption(network, 0)
+	limiter.AddClient(regularIP)
+	limiter.RemoveExemption(network)
+	limiter.AddClient(regularIP)
+	limiter.RemoveClient(regularIP)
+	limiter.RemoveClient(regularIP)
+	_, status := limiter.Status(regularIP)
+	assertEqual(status.Count, 0, t)
+
+	// counted, then exempted while connected: the count must still be released
+	limiter.AddClient(regularIP)
+	limiter.AddExemption(network, 0)
+	limiter.RemoveClient(regularIP)
+	limiter.RemoveExemption(network)
+	_, status = limiter.Status(regularIP)
+	assertEqual(status.Count, 0, t)
+}
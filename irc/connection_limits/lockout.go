@@ -0,0 +1,117 @@
+package connection_limits
+
+import (
+	"sync"
+	"time"
+)
+
+// LockoutConfig controls temporary lockouts after repeated authentication failures.
+type LockoutConfig struct {
+	Enabled bool
+	// consecutive failures before a lockout
+	Attempts int `yaml:"max-attempts"`
+	// initial lockout duration; it doubles with each further failure
+	Duration    time.Duration
+	MaxDuration time.Duration `yaml:"max-duration"`
+}
+
+type lockoutEntry struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// Lockout tracks authentication failures by key (e.g., an IP address or an
+// account name), across connections, applying exponential backoff to keys
+// that keep failing. Failures are forgotten after MaxDuration without one.
+type Lockout struct {
+	sync.Mutex
+
+	config    LockoutConfig
+	entries   map[string]lockoutEntry
+	lastSweep time.Time
+}
+
+func (l *Lockout) ApplyConfig(config LockoutConfig) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.config = config
+	if l.entries == nil || !config.Enabled {
+		l.entries = make(map[string]lockoutEntry)
+	}
+}
+
+// Check returns how much longer `key` is locked out for, or 0 if it isn't.
+func (l *Lockout) Check(key string) (remaining time.Duration) {
+	return l.check(key, time.Now().UTC())
+}
+
+func (l *Lockout) check(key string, now time.Time) (remaining time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+
+	if !l.config.Enabled {
+		return 0
+	}
+	if entry, ok := l.entries[key]; ok && now.Before(entry.lockedUntil) {
+		return entry.lockedUntil.Sub(now)
+	}
+	return 0
+}
+
+// Failure records a failed attempt; if this causes `key` to be locked out,
+// it returns the lockout duration and the number of consecutive failures.
+func (l *Lockout) Failure(key string) (lockout time.Duration, failures int) {
+	return l.failure(key, time.Now().UTC())
+}
+
+func (l *Lockout) failure(key string, now time.Time) (lockout time.Duration, failures int) {
+	l.Lock()
+	defer l.Unlock()
+
+	if !l.config.Enabled || l.config.Attempts == 0 {
+		return
+	}
+	l.sweep(now)
+
+	entry := l.entries[key]
+	if now.Sub(entry.lastFailure) > l.config.MaxDuration {
+		entry = lockoutEntry{}
+	}
+	entry.failures++
+	entry.lastFailure = now
+	if entry.failures >= l.config.Attempts {
+		lockout = l.config.Duration
+		for i := l.config.Attempts; i < entry.failures && lockout < l.config.MaxDuration; i++ {
+			lockout *= 2
+		}
+		if lockout > l.config.MaxDuration {
+			lockout = l.config.MaxDuration
+		}
+		entry.lockedUntil = now.Add(lockout)
+	}
+	l.entries[key] = entry
+	return lockout, entry.failures
+}
+
+// Success forgets any failures for `key`.
+func (l *Lockout) Success(key string) {
+	l.Lock()
+	defer l.Unlock()
+
+	delete(l.entries, key)
+}
+
+// sweep removes forgotten entries; call with the mutex held
+func (l *Lockout) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.config.MaxDuration {
+		return
+	}
+	l.lastSweep = now
+	for key, entry := range l.entries {
+		if now.Sub(entry.lastFailure) > l.config.MaxDuration {
+			delete(l.entries, key)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package connection_limits
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockout(t *testing.T) {
+	var l Lockout
+	l.ApplyConfig(LockoutConfig{
+		Enabled:     true,
+		Attempts:    3,
+		Duration:    time.Minute,
+		MaxDuration: 5 * time.Minute,
+	})
+	now := time.Now().UTC()
+
+	for i := 0; i < 2; i++ {
+		lockout, _ := l.failure("ip", now)
+		assertEqual(lockout, time.Duration(0), t)
+	}
+	assertEqual(l.check("ip", now), time.Duration(0), t)
+
+	lockout, failures := l.failure("ip", now)
+	assertEqual(lockout, time.Minute, t)
+	assertEqual(failures, 3, t)
+	assertEqual(l.check("ip", now.Add(time.Second)), time.Minute-time.Second, t)
+	assertEqual(l.check("other", now), time.Duration(0), t)
+
+	// exponential backoff, capped at the maximum
+	lockout, _ = l.failure("ip", now)
+	assertEqual(lockout, 2*time.Minute, t)
+	lockout, _ = l.failure("ip", now)
+	assertEqual(lockout, 4*time.Minute, t)
+	lockout, _ = l.failure("ip", now)
+	assertEqual(lockout, 5*time.Minute, t)
+
+	// failures are forgotten after a while
+	lockout, failures = l.failure("ip", now.Add(time.Hour))
+	assertEqual(lockout, time.Duration(0), t)
+	assertEqual(failures, 1, t)
+
+	l.Success("ip")
+	assertEqual(l.check("ip", now.Add(time.Hour)), time.Duration(0), t)
+}
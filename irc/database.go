@@ -87,8 +87,38 @@ func initializeDB(path string) error {
 }
 
 // OpenDatabase returns an existing database, performing a schema version check.
-func OpenDatabase(config *Config) (*buntdb.DB, error) {
-	return openDatabaseInternal(config, config.Datastore.AutoUpgrade)
+func OpenDatabase(config *Config) (db *buntdb.DB, err error) {
+	db, err = openDatabaseInternal(config, config.Datastore.AutoUpgrade)
+	if err != nil {
+		return
+	}
+	// the datastore file is an append-only journal of every write; on startup,
+	// a partially written final entry (from a crash) is discarded. the sync
+	// policy controls how many of the most recent writes a crash can lose:
+	var dbConfig buntdb.Config
+	if err = db.ReadConfig(&dbConfig); err == nil {
+		dbConfig.SyncPolicy, _ = syncPolicyFromString(config.Datastore.Sync)
+		err = db.SetConfig(dbConfig)
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// syncPolicyFromString parses the datastore.sync config value.
+func syncPolicyFromString(str string) (buntdb.SyncPolicy, error) {
+	switch strings.ToLower(str) {
+	case "", "every-second":
+		return buntdb.EverySecond, nil
+	case "always":
+		return buntdb.Always, nil
+	case "never":
+		return buntdb.Never, nil
+	default:
+		return buntdb.EverySecond, fmt.Errorf("invalid datastore sync policy: %s", str)
+	}
 }
 
 // open the database, giving it at most one chance to auto-upgrade the schema
@@ -167,6 +197,28 @@ func performAutoUpgrade(currentVersion int, config *Config) (err error) {
 	return err
 }
 
+// SchemaVersion returns the schema version of the datastore, along with the
+// latest version supported by this build (to which UpgradeDB would upgrade it).
+func SchemaVersion(config *Config) (version, latest int, err error) {
+	// as in UpgradeDB, don't create the database if it doesn't exist
+	_, err = os.Stat(config.Datastore.Path)
+	if err != nil {
+		return
+	}
+
+	store, err := buntdb.Open(config.Datastore.Path)
+	if err != nil {
+		return
+	}
+	defer store.Close()
+
+	err = store.View(func(tx *buntdb.Tx) (err error) {
+		version, err = retrieveSchemaVersion(tx)
+		return err
+	})
+	return version, latestDbSchema, err
+}
+
 // UpgradeDB upgrades the datastore to the latest schema.
 func UpgradeDB(config *Config) (err error) {
 	// #715: test that the database exists
@@ -0,0 +1,202 @@
+package irc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ergochat/ergo/irc/flatip"
+)
+
+const (
+	// DefaultDNSBLTimeout bounds the DNSBL queries for a single connection
+	// (the default for server.dnsbl.timeout)
+	DefaultDNSBLTimeout = 5 * time.Second
+)
+
+// DNSBLConfig controls checking of connecting IPs against DNS blocklists.
+type DNSBLConfig struct {
+	Enabled       bool
+	Timeout       time.Duration
+	CacheDuration time.Duration `yaml:"cache-duration"`
+	Lists         []DNSBLListConfig
+}
+
+// DNSBLListConfig describes a single DNS blocklist and what to do with listed IPs.
+type DNSBLListConfig struct {
+	Host string
+	// if nonempty, only these A records count as a listing:
+	Replies []string
+	Action  string
+	action  IPScriptResult
+	Reason  string
+}
+
+func (conf *DNSBLConfig) postprocess() (err error) {
+	if !conf.Enabled {
+		return nil
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = DefaultDNSBLTimeout
+	}
+	for i := range conf.Lists {
+		list := &conf.Lists[i]
+		list.Host = strings.Trim(strings.ToLower(list.Host), ".")
+		if list.Host == "" {
+			return fmt.Errorf("dnsbl lists must have a host")
+		}
+		switch strings.ToLower(list.Action) {
+		case "", "reject":
+			list.action = IPBanned
+		case "require-sasl":
+			list.action = IPRequireSASL
+		default:
+			return fmt.Errorf("invalid action for dnsbl %s: %s", list.Host, list.Action)
+		}
+		if list.Reason == "" {
+			list.Reason = fmt.Sprintf("Your IP is listed in %s", list.Host)
+		}
+	}
+	return nil
+}
+
+// dnsblQueryName returns the name to look up to check `ip` against the list
+// at `zone`: the reversed octets (IPv4) or nibbles (IPv6) of the address,
+// followed by the zone.
+func dnsblQueryName(ip net.IP, zone string) string {
+	var buf strings.Builder
+	if ip4 := ip.To4(); ip4 != nil {
+		for i := len(ip4) - 1; i >= 0; i-- {
+			fmt.Fprintf(&buf, "%d.", ip4[i])
+		}
+	} else {
+		ip16 := ip.To16()
+		const hexDigits = "0123456789abcdef"
+		for i := len(ip16) - 1; i >= 0; i-- {
+			buf.WriteByte(hexDigits[ip16[i]&0xf])
+			buf.WriteByte('.')
+			buf.WriteByte(hexDigits[ip16[i]>>4])
+			buf.WriteByte('.')
+		}
+	}
+	buf.WriteString(zone)
+	return buf.String()
+}
+
+// CheckDNSBL queries all configured lists concurrently, returning the first
+// (in config order) that lists `ip`, or nil if none of them do. `complete`
+// is false if any of the lookups failed (rather than returning a listing
+// or NXDOMAIN), in which case a nil result shouldn't be cached.
+func CheckDNSBL(config *DNSBLConfig, ip net.IP) (listed *DNSBLListConfig, complete bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+	defer cancel()
+
+	results := make([]bool, len(config.Lists))
+	failures := make([]bool, len(config.Lists))
+	done := make(chan struct{}, len(config.Lists))
+	for i := range config.Lists {
+		go func(i int) {
+			defer func() { done <- struct{}{} }()
+			list := &config.Lists[i]
+			addrs, err := net.DefaultResolver.LookupHost(ctx, dnsblQueryName(ip, list.Host))
+			if err != nil {
+				// NXDOMAIN means not listed; anything else is a failed lookup,
+				// and we fail open
+				var dnsErr *net.DNSError
+				failures[i] = !(errors.As(err, &dnsErr) && dnsErr.IsNotFound)
+				return
+			}
+			if len(list.Replies) == 0 {
+				results[i] = len(addrs) != 0
+				return
+			}
+			for _, addr := range addrs {
+				if slices.Contains(list.Replies, addr) {
+					results[i] = true
+					return
+				}
+			}
+		}(i)
+	}
+	for range config.Lists {
+		<-done
+	}
+
+	for i, result := range results {
+		if result {
+			return &config.Lists[i], true
+		}
+	}
+	return nil, !slices.Contains(failures, true)
+}
+
+type dnsblCacheEntry struct {
+	listed     *DNSBLListConfig // nil if the IP isn't listed
+	expiration time.Time
+}
+
+// DNSBLCache remembers the results of DNSBL checks, both positive and negative,
+// so that reconnecting clients don't have to be checked again.
+type DNSBLCache struct {
+	sync.Mutex
+
+	entries   map[flatip.IP]dnsblCacheEntry
+	lastSweep time.Time
+}
+
+// ApplyConfig forgets all cached results, since the lists may have changed.
+func (c *DNSBLCache) ApplyConfig() {
+	c.Lock()
+	defer c.Unlock()
+
+	c.entries = nil
+}
+
+// Get returns the cached result for `ip`, if there is one.
+func (c *DNSBLCache) Get(ip flatip.IP) (listed *DNSBLListConfig, ok bool) {
+	return c.get(ip, time.Now().UTC())
+}
+
+func (c *DNSBLCache) get(ip flatip.IP, now time.Time) (listed *DNSBLListConfig, ok bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	entry, ok := c.entries[ip]
+	if !ok || !now.Before(entry.expiration) {
+		return nil, false
+	}
+	return entry.listed, true
+}
+
+// Add caches the result of checking `ip` for `duration` (0 disables caching).
+func (c *DNSBLCache) Add(ip flatip.IP, listed *DNSBLListConfig, duration time.Duration) {
+	c.add(ip, listed, duration, time.Now().UTC())
+}
+
+func (c *DNSBLCache) add(ip flatip.IP, listed *DNSBLListConfig, duration time.Duration, now time.Time) {
+	if duration <= 0 {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[flatip.IP]dnsblCacheEntry)
+	}
+	// periodically clean up expired entries
+	if duration <= now.Sub(c.lastSweep) {
+		c.lastSweep = now
+		for cachedIP, entry := range c.entries {
+			if !now.Before(entry.expiration) {
+				delete(c.entries, cachedIP)
+			}
+		}
+	}
+	c.entries[ip] = dnsblCacheEntry{listed: listed, expiration: now.Add(duration)}
+}
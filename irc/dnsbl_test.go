@@ -0,0 +1,69 @@
+package irc
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ergochat/ergo/irc/flatip"
+)
+
+func TestDNSBLQueryName(t *testing.T) {
+	assertEqual(dnsblQueryName(net.ParseIP("192.0.2.99"), "dnsbl.dronebl.org"), "99.2.0.192.dnsbl.dronebl.org")
+	assertEqual(
+		dnsblQueryName(net.ParseIP("2001:db8::567:89ab"), "dnsbl.example"),
+		"b.a.9.8.7.6.5.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.dnsbl.example",
+	)
+}
+
+func TestDNSBLConfig(t *testing.T) {
+	conf := DNSBLConfig{
+		Enabled: true,
+		Lists: []DNSBLListConfig{
+			{Host: "dnsbl.dronebl.org."},
+			{Host: "rbl.example", Action: "require-sasl", Reason: "Please log in"},
+		},
+	}
+	if err := conf.postprocess(); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(conf.Timeout, DefaultDNSBLTimeout)
+	assertEqual(conf.Lists[0].Host, "dnsbl.dronebl.org")
+	assertEqual(conf.Lists[0].action, IPBanned)
+	assertEqual(conf.Lists[0].Reason, "Your IP is listed in dnsbl.dronebl.org")
+	assertEqual(conf.Lists[1].action, IPRequireSASL)
+
+	conf.Lists = append(conf.Lists, DNSBLListConfig{Host: "bad.example", Action: "explode"})
+	if err := conf.postprocess(); err == nil {
+		t.Error("invalid dnsbl action should be rejected")
+	}
+}
+
+func TestDNSBLCache(t *testing.T) {
+	var cache DNSBLCache
+	listed := &DNSBLListConfig{Host: "dnsbl.example"}
+	badIP := flatip.FromNetIP(net.ParseIP("192.0.2.1"))
+	goodIP := flatip.FromNetIP(net.ParseIP("192.0.2.2"))
+	now := time.Now().UTC()
+
+	cache.add(badIP, listed, time.Hour, now)
+	cache.add(goodIP, nil, time.Hour, now)
+	result, ok := cache.get(badIP, now.Add(time.Minute))
+	assertEqual(result, listed)
+	assertEqual(ok, true)
+	result, ok = cache.get(goodIP, now.Add(time.Minute))
+	assertEqual(result, (*DNSBLListConfig)(nil))
+	assertEqual(ok, true)
+
+	// entries expire
+	_, ok = cache.get(badIP, now.Add(2*time.Hour))
+	assertEqual(ok, false)
+	// and are swept
+	cache.add(flatip.FromNetIP(net.ParseIP("192.0.2.3")), nil, time.Hour, now.Add(2*time.Hour))
+	assertEqual(len(cache.entries), 1)
+
+	// rehashing forgets everything
+	cache.ApplyConfig()
+	_, ok = cache.get(goodIP, now)
+	assertEqual(ok, false)
+}
@@ -28,11 +28,15 @@ var (
 	errAccountAlreadyLoggedIn         = errors.New("You're already logged into an account")
 	errAccountTooManyNicks            = errors.New("Account has too many reserved nicks")
 	errAccountUnverified              = errors.New(`Account is not yet verified`)
+	errAccountRequiresTLS             = errors.New(`This account may only be used over TLS`)
 	errAccountSuspended               = errors.New(`Account has been suspended`)
 	errAccountVerificationFailed      = errors.New("Account verification failed")
 	errAccountVerificationInvalidCode = errors.New("Invalid account verification code")
 	errAccountUpdateFailed            = errors.New(`Error while updating your account information`)
 	errAccountMustHoldNick            = errors.New(`You must hold that nickname in order to register it`)
+	errInvalidTwoFactorCode           = errors.New(`Invalid two-factor authentication code`)
+	errTwoFactorAlreadyEnabled        = errors.New(`Two-factor authentication is already enabled`)
+	errTwoFactorNotEnabled            = errors.New(`Two-factor authentication is not enabled`)
 	errAuthzidAuthcidMismatch         = errors.New(`authcid and authzid must be the same`)
 	errCertfpAlreadyExists            = errors.New(`An account already exists for your certificate fingerprint`)
 	errChannelNotOwnedByAccount       = errors.New("Channel not owned by the specified account")
@@ -40,6 +44,7 @@ var (
 	errChannelAlreadyRegistered       = errors.New("Channel is already registered")
 	errChannelNotRegistered           = errors.New("Channel is not registered")
 	errChannelNameInUse               = errors.New(`Channel name in use`)
+	errLocalChannel                   = errors.New("Local channels cannot be registered")
 	errInvalidChannelName             = errors.New(`Invalid channel name`)
 	errMonitorLimitExceeded           = errors.New("Monitor limit exceeded")
 	errNickMissing                    = errors.New("nick missing")
@@ -47,8 +52,16 @@ var (
 	errNicknameInUse                  = errors.New("nickname in use")
 	errInsecureReattach               = errors.New("insecure reattach")
 	errNicknameReserved               = errors.New("nickname is reserved")
+	errNicknameDelayed                = errors.New("nickname is temporarily unavailable")
 	errNickAccountMismatch            = errors.New(`Your nickname must match your account name; try logging out and logging back in with SASL`)
 	errNoExistingBan                  = errors.New("Ban does not exist")
+	errAPITokenExists                 = errors.New("An API token with that name already exists")
+	errAPITokenNotFound               = errors.New("No API token with that name exists")
+	errAPITokenBadScope               = errors.New("Invalid API token scope")
+	errAPITokenBadName                = errors.New("Invalid API token name")
+	errAPITokenUnexpected             = errors.New("Unexpected error storing API token")
+	errCPUProfileRunning              = errors.New("CPU profiling is already in progress")
+	errCPUProfileNotRunning           = errors.New("CPU profiling is not in progress")
 	errNoSuchChannel                  = errors.New(`No such channel`)
 	errChannelPurged                  = errors.New(`This channel was purged by the server operators and cannot be used`)
 	errChannelPurgedAlready           = errors.New(`This channel was already purged and cannot be purged again`)
@@ -33,6 +33,9 @@ type Fakelag struct {
 	state      FakelagState
 	burstCount uint // number of messages sent in the current burst
 	lastTouch  time.Time
+	// estimate of how far behind the client's input we are, i.e.,
+	// how much time we've spent sleeping that the client hasn't made up
+	lag time.Duration
 }
 
 func (fl *Fakelag) Initialize(config FakelagConfig) {
@@ -62,8 +65,9 @@ func (fl *Fakelag) Unsuspend() {
 	}
 }
 
-// register a new command, sleep if necessary to delay it
-func (fl *Fakelag) Touch(command string) {
+// register a new command, sleep if necessary to delay it; returns whether
+// the client has exceeded max-lag and should be disconnected for flooding
+func (fl *Fakelag) Touch(command string) (flooded bool) {
 	if !fl.config.Enabled {
 		return
 	}
@@ -90,6 +94,7 @@ func (fl *Fakelag) Touch(command string) {
 			fl.burstCount = 0
 			// transition to throttling
 			fl.state = FakelagThrottled
+			fl.lag = 0
 			// continue to throttling logic
 		} else {
 			return
@@ -101,6 +106,7 @@ func (fl *Fakelag) Touch(command string) {
 			// let them burst again
 			fl.state = FakelagBursting
 			fl.burstCount = 1
+			fl.lag = 0
 			return
 		}
 		var sleepDuration time.Duration
@@ -114,10 +120,19 @@ func (fl *Fakelag) Touch(command string) {
 			fl.state = FakelagBursting
 			fl.burstCount = 1
 		}
+		// time the client spends not sending commands makes up for previous sleeps
+		fl.lag += sleepDuration
+		if fl.lag < 0 {
+			fl.lag = 0
+		}
+		if fl.config.MaxLag != 0 && fl.lag > fl.config.MaxLag {
+			return true
+		}
 		if sleepDuration > 0 {
 			fl.sleepFunc(sleepDuration)
 			// the touch time should take into account the time we slept
 			fl.lastTouch = fl.nowFunc()
 		}
 	}
+	return
 }
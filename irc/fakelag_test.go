@@ -153,3 +153,26 @@ func TestSuspend(t *testing.T) {
 	fl2.Unsuspend()
 	assertEqual(fl2.config.Enabled, false)
 }
+
+func TestFakelagMaxLag(t *testing.T) {
+	window, _ := time.ParseDuration("1s")
+	fl, mt := newFakelagForTesting(window, 3, 2, window)
+	fl.config.MaxLag = 2 * window
+
+	for i := 0; i < 3; i++ {
+		assertEqual(fl.Touch(""), false)
+	}
+	// every message sent without a pause puts us 500 msec further behind
+	for i := 0; i < 4; i++ {
+		assertEqual(fl.Touch(""), false)
+	}
+	assertEqual(fl.lag, 2*window)
+
+	// pausing lets the client catch up
+	mt.pause(900 * time.Millisecond)
+	assertEqual(fl.Touch(""), false)
+	assertEqual(fl.lag, 1600*time.Millisecond)
+
+	// exceeding max-lag reports a flood
+	assertEqual(fl.Touch(""), true)
+}
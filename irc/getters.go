@@ -274,6 +274,18 @@ func (client *Client) Oper() *Oper {
 	return client.oper
 }
 
+func (client *Client) StaffListed() (result bool) {
+	client.stateMutex.RLock()
+	defer client.stateMutex.RUnlock()
+	return client.staffListed
+}
+
+func (client *Client) SetStaffListed(listed bool) {
+	client.stateMutex.Lock()
+	defer client.stateMutex.Unlock()
+	client.staffListed = listed && client.oper != nil
+}
+
 func (client *Client) Registered() (result bool) {
 	// `registered` is only written from the client's own goroutine, but may be
 	// read from other goroutines; therefore, the client's own goroutine may read
@@ -468,9 +480,15 @@ func (client *Client) detailsNoMutex() (result ClientDetails) {
 func (client *Client) UpdateActive(session *Session) {
 	now := time.Now().UTC()
 	client.stateMutex.Lock()
-	defer client.stateMutex.Unlock()
 	client.lastActive = now
 	session.lastActive = now
+	wasIdle := client.idleNotified
+	client.idleNotified = false
+	client.stateMutex.Unlock()
+
+	if wasIdle {
+		dispatchIdleNotify(client, 0)
+	}
 }
 
 func (client *Client) Realname() string {
@@ -23,7 +23,6 @@ import (
 	"github.com/ergochat/irc-go/ircfmt"
 	"github.com/ergochat/irc-go/ircmsg"
 	"github.com/ergochat/irc-go/ircutils"
-	"golang.org/x/crypto/bcrypt"
 
 	"github.com/ergochat/ergo/irc/caps"
 	"github.com/ergochat/ergo/irc/custime"
@@ -31,6 +30,7 @@ import (
 	"github.com/ergochat/ergo/irc/history"
 	"github.com/ergochat/ergo/irc/jwt"
 	"github.com/ergochat/ergo/irc/modes"
+	"github.com/ergochat/ergo/irc/passwd"
 	"github.com/ergochat/ergo/irc/sno"
 	"github.com/ergochat/ergo/irc/utils"
 )
@@ -180,6 +180,51 @@ func acceptHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respo
 	return false
 }
 
+// APITOKEN CREATE <name> <scope>[,<scope>...]
+// APITOKEN LIST
+// APITOKEN REVOKE <name>
+func apitokenHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	operName := client.Oper().Name
+	switch strings.ToUpper(msg.Params[0]) {
+	case "CREATE":
+		if len(msg.Params) < 3 {
+			rb.Add(nil, server.name, ERR_NEEDMOREPARAMS, client.Nick(), "APITOKEN", client.t("Not enough parameters"))
+			return false
+		}
+		name := msg.Params[1]
+		scopes := strings.Split(strings.ToLower(msg.Params[2]), ",")
+		token, err := server.CreateAPIToken(name, scopes, operName)
+		if err != nil {
+			rb.Add(nil, server.name, "FAIL", "APITOKEN", "CREATE_FAILED", utils.SafeErrorParam(name), client.t(err.Error()))
+			return false
+		}
+		rb.Notice(fmt.Sprintf(client.t("Created API token %[1]s with scopes %[2]s: %[3]s"), name, strings.Join(scopes, ","), token))
+		rb.Notice(client.t("Store this token now; it cannot be displayed again"))
+		server.logger.Info("opers", "oper", operName, "created API token", name, "with scopes", strings.Join(scopes, ","))
+	case "LIST":
+		tokens := server.ListAPITokens()
+		for _, info := range tokens {
+			rb.Notice(fmt.Sprintf(client.t("API token %[1]s: scopes %[2]s, created by %[3]s at %[4]s"), info.Name, strings.Join(info.Scopes, ","), info.OperName, client.formatTime(info.TimeCreated)))
+		}
+		rb.Notice(fmt.Sprintf(client.t("There are %d API tokens"), len(tokens)))
+	case "REVOKE":
+		if len(msg.Params) < 2 {
+			rb.Add(nil, server.name, ERR_NEEDMOREPARAMS, client.Nick(), "APITOKEN", client.t("Not enough parameters"))
+			return false
+		}
+		name := msg.Params[1]
+		if err := server.RevokeAPIToken(name); err != nil {
+			rb.Add(nil, server.name, "FAIL", "APITOKEN", "REVOKE_FAILED", utils.SafeErrorParam(name), client.t(err.Error()))
+			return false
+		}
+		rb.Notice(fmt.Sprintf(client.t("Revoked API token %s"), name))
+		server.logger.Info("opers", "oper", operName, "revoked API token", name)
+	default:
+		rb.Add(nil, server.name, "FAIL", "APITOKEN", "UNKNOWN_COMMAND", utils.SafeErrorParam(msg.Params[0]), client.t("Unknown subcommand"))
+	}
+	return false
+}
+
 // AUTHENTICATE [<mechanism>|<data>|*]
 func authenticateHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
 	session := rb.session
@@ -333,7 +378,8 @@ func authErrorToMessage(server *Server, err error) (msg string) {
 	}
 
 	switch err {
-	case errAccountDoesNotExist, errAccountUnverified, errAccountInvalidCredentials, errAuthzidAuthcidMismatch, errNickAccountMismatch, errAccountSuspended:
+	case errAccountDoesNotExist, errAccountUnverified, errAccountInvalidCredentials, errAuthzidAuthcidMismatch, errNickAccountMismatch, errAccountSuspended,
+		errAccountRequiresTLS:
 		return err.Error()
 	default:
 		// don't expose arbitrary error messages to the user
@@ -417,8 +463,26 @@ func authScramHandler(server *Server, client *Client, session *Session, value []
 				rb.Add(nil, server.name, ERR_SASLFAIL, client.nick, client.t("SASL authentication failed: authcid and authzid should be the same"))
 				return false
 			}
+			ipKey, accountKey := server.lockoutKeyIP(client.IP()), lockoutKeyAccount(authcid)
+			if remainingTime := server.checkLoginLockout(ipKey); remainingTime != 0 {
+				sendAuthErrorResponse(client, rb, &ThrottleError{remainingTime})
+				return false
+			}
+			server.throttleLogin(accountKey)
 			account, err := server.accounts.LoadAccount(authcid)
+			if err == nil && server.Config().Accounts.TOTP.Enabled && server.TwoFactorEnabled(fmt.Sprintf(keyAccountTOTP, account.NameCasefolded)) {
+				// SCRAM can't carry the code, so it can't be used with two-factor authentication;
+				// fail the same way as a bad password, so as not to confirm that the password was correct
+				server.loginFailed(client, sno.LocalAccounts, ipKey, accountKey)
+				rb.Add(nil, server.name, ERR_SASLFAIL, client.nick, client.t("SASL authentication failed"))
+				return false
+			}
+			if err == nil && server.accounts.requiresTLS(client, account.NameCasefolded) {
+				sendAuthErrorResponse(client, rb, errAccountRequiresTLS)
+				return false
+			}
 			if err == nil {
+				server.loginSucceeded(accountKey)
 				server.accounts.Login(client, account)
 				if fixupNickEqualsAccount(client, rb, server.Config(), "") {
 					sendSuccessfulAccountAuth(nil, client, rb, true)
@@ -428,6 +492,7 @@ func authScramHandler(server *Server, client *Client, session *Session, value []
 				rb.Add(nil, server.name, ERR_SASLFAIL, client.nick, client.t("SASL authentication failed"))
 			}
 		} else {
+			server.loginFailed(client, sno.LocalAccounts, server.lockoutKeyIP(client.IP()), lockoutKeyAccount(session.sasl.scramConv.Username()))
 			rb.Add(nil, server.name, ERR_SASLFAIL, client.nick, client.t("SASL authentication failed"))
 		}
 		return false
@@ -482,6 +547,20 @@ func dispatchAwayNotify(client *Client, awayMessage string) {
 	}
 }
 
+// dispatchIdleNotify tells ergo.chat/idle-notify clients that `client` has been
+// idle for `idleSeconds` seconds, or, if `idleSeconds` is 0, that it is active again.
+func dispatchIdleNotify(client *Client, idleSeconds uint64) {
+	details := client.Details()
+	isBot := client.HasMode(modes.Bot)
+	for session := range client.FriendsMonitors(caps.IdleNotify) {
+		if idleSeconds != 0 {
+			session.sendFromClientInternal(false, time.Time{}, "", details.nickMask, details.accountName, isBot, nil, "IDLE", strconv.FormatUint(idleSeconds, 10))
+		} else {
+			session.sendFromClientInternal(false, time.Time{}, "", details.nickMask, details.accountName, isBot, nil, "IDLE")
+		}
+	}
+}
+
 // BATCH {+,-}reference-tag type [params...]
 func batchHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
 	tag := msg.Params[0]
@@ -790,6 +869,68 @@ func chathistoryHandler(server *Server, client *Client, msg ircmsg.Message, rb *
 	return
 }
 
+// CONNEXEMPT ADD <ip/cidr> [DURATION <duration>]
+// CONNEXEMPT DEL <ip/cidr>
+// CONNEXEMPT LIST
+func connexemptHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	subcommand := strings.ToLower(msg.Params[0])
+	if subcommand == "list" {
+		exemptions := server.connectionLimiter.Exemptions()
+		networks := make([]flatip.IPNet, 0, len(exemptions))
+		for network := range exemptions {
+			networks = append(networks, network)
+		}
+		sort.Slice(networks, func(i, j int) bool { return networks[i].String() < networks[j].String() })
+		for _, network := range networks {
+			if expiration := exemptions[network]; expiration.IsZero() {
+				rb.Notice(network.HumanReadableString())
+			} else {
+				rb.Notice(fmt.Sprintf(client.t("%[1]s [expires in %[2]v]"), network.HumanReadableString(), time.Until(expiration).Truncate(time.Second)))
+			}
+		}
+		rb.Notice(fmt.Sprintf(client.t("There are %d active connection limit exemption(s)"), len(networks)))
+		return false
+	}
+
+	if len(msg.Params) < 2 {
+		rb.Add(nil, server.name, ERR_NEEDMOREPARAMS, client.Nick(), msg.Command, client.t("Not enough parameters"))
+		return false
+	}
+	network, err := flatip.ParseToNormalizedNet(msg.Params[1])
+	if err != nil {
+		rb.Notice(client.t("Could not parse IP address or CIDR network"))
+		return false
+	}
+
+	var line string
+	switch subcommand {
+	case "add":
+		duration, _, _, err := consumeDuration(msg.Params[2:], rb)
+		if err != nil {
+			return false
+		}
+		server.connectionLimiter.AddExemption(network, duration)
+		rb.Notice(fmt.Sprintf(client.t("Exempted %s from connection limits"), network.HumanReadableString()))
+		line = fmt.Sprintf("Operator %s exempted %s from connection limits", client.Oper().Name, network.HumanReadableString())
+		if duration != 0 {
+			line += fmt.Sprintf(" [duration: %v]", duration)
+		}
+	case "del", "remove", "rm":
+		if !server.connectionLimiter.RemoveExemption(network) {
+			rb.Notice(fmt.Sprintf(client.t("No exemption found for %s"), network.HumanReadableString()))
+			return false
+		}
+		rb.Notice(fmt.Sprintf(client.t("Removed connection limit exemption for %s"), network.HumanReadableString()))
+		line = fmt.Sprintf("Operator %s removed connection limit exemption for %s", client.Oper().Name, network.HumanReadableString())
+	default:
+		rb.Notice(client.t("Unknown command"))
+		return false
+	}
+	server.snomasks.Send(sno.LocalXline, line)
+	server.logger.Info("opers", line)
+	return false
+}
+
 // DEBUG <subcmd>
 func debugHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
 	param := strings.ToUpper(msg.Params[0])
@@ -816,7 +957,7 @@ func debugHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respon
 		rb.Notice(fmt.Sprintf("num goroutines: %d", count))
 
 	case "PROFILEHEAP":
-		profFile := server.Config().getOutputPath("ergo.mprof")
+		profFile := server.profileFilename("mprof")
 		file, err := os.Create(profFile)
 		if err != nil {
 			rb.Notice(fmt.Sprintf("error: %s", err))
@@ -827,23 +968,43 @@ func debugHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respon
 		rb.Notice(fmt.Sprintf("written to %s", profFile))
 
 	case "STARTCPUPROFILE":
-		profFile := server.Config().getOutputPath("ergo.prof")
-		file, err := os.Create(profFile)
+		profile, err := server.startCPUProfile()
 		if err != nil {
 			rb.Notice(fmt.Sprintf("error: %s", err))
 			break
 		}
-		if err := pprof.StartCPUProfile(file); err != nil {
-			defer file.Close()
+		rb.Notice(fmt.Sprintf("CPU profile writing to %s", profile.Name()))
+
+	case "STOPCPUPROFILE":
+		profFile, err := server.stopCPUProfile(nil)
+		if err != nil {
 			rb.Notice(fmt.Sprintf("error: %s", err))
 			break
 		}
+		rb.Notice(fmt.Sprintf("CPU profiling stopped, written to %s", profFile))
 
-		rb.Notice(fmt.Sprintf("CPU profile writing to %s", profFile))
-
-	case "STOPCPUPROFILE":
-		pprof.StopCPUProfile()
-		rb.Notice(fmt.Sprintf("CPU profiling stopped"))
+	case "CPUPROFILE":
+		seconds := 0
+		if len(msg.Params) > 1 {
+			seconds, _ = strconv.Atoi(msg.Params[1])
+		}
+		if seconds < 1 || maxCPUProfileSeconds < seconds {
+			rb.Notice(fmt.Sprintf("usage: DEBUG CPUPROFILE <seconds>, where seconds is between 1 and %d", maxCPUProfileSeconds))
+			break
+		}
+		profile, err := server.startCPUProfile()
+		if err != nil {
+			rb.Notice(fmt.Sprintf("error: %s", err))
+			break
+		}
+		rb.Notice(fmt.Sprintf("CPU profile writing to %s for %d seconds", profile.Name(), seconds))
+		time.AfterFunc(time.Duration(seconds)*time.Second, func() {
+			// this fails harmlessly if it was stopped early with STOPCPUPROFILE,
+			// even if another profile has been started since
+			if profFile, err := server.stopCPUProfile(profile); err == nil {
+				client.Notice(fmt.Sprintf("CPU profile written to %s", profFile))
+			}
+		})
 
 	case "CRASHSERVER":
 		code := utils.ConfirmationCode(server.name, server.ctime)
@@ -908,6 +1069,50 @@ func formatBanForListing(client *Client, key string, info IPBanInfo) string {
 	return fmt.Sprintf(client.t("%[1]s - %[2]s - added by %[3]s - %[4]s"), banType, key, info.OperName, desc)
 }
 
+// listBans lists the given D-lines or K-lines, oldest first
+func listBans(client *Client, bans map[string]IPBanInfo, emptyMessage string, rb *ResponseBuffer) {
+	if len(bans) == 0 {
+		rb.Notice(emptyMessage)
+		return
+	}
+
+	keys := make([]string, 0, len(bans))
+	for key := range bans {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ti, tj := bans[keys[i]].TimeCreated, bans[keys[j]].TimeCreated
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return keys[i] < keys[j]
+	})
+	for _, key := range keys {
+		rb.Notice(formatBanForListing(client, key, bans[key]))
+	}
+}
+
+// DIE [reason]
+func dieHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	operShutdown(server, client, msg, false, rb)
+	return false
+}
+
+// operShutdown implements DIE and RESTART, which use the same orderly
+// shutdown as an exit signal.
+func operShutdown(server *Server, client *Client, msg ircmsg.Message, restart bool, rb *ResponseBuffer) {
+	message := "Server is shutting down"
+	if restart {
+		message = "Server is restarting"
+	}
+	if len(msg.Params) != 0 && msg.Params[0] != "" {
+		message = fmt.Sprintf("%s (%s)", message, msg.Params[0])
+	}
+	server.logger.Warning("server", msg.Command, "command used by", client.NickMaskString(), "oper", client.Oper().Name)
+	rb.Notice(client.t("Shutting down the server"))
+	server.StopWithMessage(message, restart)
+}
+
 // DLINE [ANDKILL] [MYSELF] [duration] <ip>/<net> [ON <server>] [reason [| oper reason]]
 // DLINE LIST
 func dlineHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
@@ -922,16 +1127,7 @@ func dlineHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respon
 
 	// if they say LIST, we just list the current dlines
 	if len(msg.Params) == currentArg+1 && strings.ToLower(msg.Params[currentArg]) == "list" {
-		bans := server.dlines.AllBans()
-
-		if len(bans) == 0 {
-			rb.Notice(client.t("No DLINEs have been set!"))
-		}
-
-		for key, info := range bans {
-			client.Notice(formatBanForListing(client, key, info))
-		}
-
+		listBans(client, server.dlines.AllBans(), client.t("No DLINEs have been set!"), rb)
 		return false
 	}
 
@@ -993,6 +1189,10 @@ func dlineHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respon
 		operName = server.name
 	}
 
+	if !server.checkOperActionLimit(client, "DLINE", rb) {
+		return false
+	}
+
 	err = server.dlines.AddNetwork(flatip.FromNetIPNet(hostNet), duration, false, reason, operReason, operName)
 
 	if err != nil {
@@ -1003,7 +1203,7 @@ func dlineHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respon
 	var snoDescription string
 	hostString = utils.NetToNormalizedString(hostNet)
 	if duration != 0 {
-		rb.Notice(fmt.Sprintf(client.t("Added temporary (%[1]s) D-Line for %[2]s"), duration.String(), hostString))
+		rb.Notice(fmt.Sprintf(client.t("Added temporary (%[1]s) D-Line for %[2]s"), client.formatDuration(duration), hostString))
 		snoDescription = fmt.Sprintf(ircfmt.Unescape("%s [%s]$r added temporary (%s) D-Line for %s"), client.nick, operName, duration.String(), hostString)
 	} else {
 		rb.Notice(fmt.Sprintf(client.t("Added D-Line for %s"), hostString))
@@ -1016,6 +1216,7 @@ func dlineHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respon
 		var sessionsToKill []*Session
 		var killedClientNicks []string
 
+		nickDelay := server.Config().Server.NickDelay
 		for _, mcl := range server.clients.AllClients() {
 			nickKilled := false
 			for _, session := range mcl.Sessions() {
@@ -1023,6 +1224,7 @@ func dlineHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respon
 					sessionsToKill = append(sessionsToKill, session)
 					if !nickKilled {
 						killedClientNicks = append(killedClientNicks, mcl.Nick())
+						server.clients.DelayNick(mcl, nickDelay)
 						nickKilled = true
 					}
 				}
@@ -1191,7 +1393,7 @@ func infoHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 		rb.Add(nil, server.name, RPL_INFO, nick, fmt.Sprintf(client.t("It was built from git hash %s."), Commit))
 	}
 	rb.Add(nil, server.name, RPL_INFO, nick, fmt.Sprintf(client.t("It was compiled using %s."), runtime.Version()))
-	rb.Add(nil, server.name, RPL_INFO, nick, fmt.Sprintf(client.t("This server has been running since %s."), server.ctime.Format(time.RFC1123)))
+	rb.Add(nil, server.name, RPL_INFO, nick, fmt.Sprintf(client.t("This server has been running since %s."), client.formatTime(server.ctime)))
 	rb.Add(nil, server.name, RPL_INFO, nick, "")
 	rb.Add(nil, server.name, RPL_INFO, nick, client.t("Ergo is released under the MIT license."))
 	rb.Add(nil, server.name, RPL_INFO, nick, "")
@@ -1221,8 +1423,19 @@ func infoHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 
 // INVITE <nickname> <channel>
 // UNINVITE <nickname> <channel>
+// INVITE
 func inviteHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
 	invite := msg.Command == "INVITE"
+	if invite && len(msg.Params) == 0 {
+		for _, chname := range client.PendingInvites() {
+			rb.Add(nil, server.name, RPL_INVITEDLIST, client.Nick(), chname)
+		}
+		rb.Add(nil, server.name, RPL_ENDOFINVITEDLIST, client.Nick(), client.t("End of /INVITE list"))
+		return false
+	} else if len(msg.Params) < 2 {
+		rb.Add(nil, server.name, ERR_NEEDMOREPARAMS, client.Nick(), msg.Command, client.t("Not enough parameters"))
+		return false
+	}
 	nickname := msg.Params[0]
 	channelName := msg.Params[1]
 
@@ -1344,7 +1557,7 @@ func sendJoinError(client *Client, name string, rb *ResponseBuffer, err error) {
 func sajoinHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
 	var target *Client
 	var channelString string
-	if strings.HasPrefix(msg.Params[0], "#") {
+	if isChannelName(msg.Params[0]) {
 		target = client
 		channelString = msg.Params[0]
 	} else {
@@ -1454,6 +1667,8 @@ func killHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 	if target == nil {
 		rb.Add(nil, client.server.name, ERR_NOSUCHNICK, client.Nick(), utils.SafeErrorParam(nickname), client.t("No such nick"))
 		return false
+	} else if !server.checkOperActionLimit(client, "KILL", rb) {
+		return false
 	} else if target.AlwaysOn() {
 		rb.Add(nil, client.server.name, ERR_UNKNOWNERROR, client.Nick(), "KILL", fmt.Sprintf(client.t("Client %s is always-on and cannot be fully removed by /KILL; consider /UBAN ADD instead"), target.Nick()))
 	}
@@ -1471,6 +1686,7 @@ func killHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 	}
 	server.snomasks.Send(sno.LocalKills, snoLine)
 
+	server.clients.DelayNick(target, server.Config().Server.NickDelay)
 	target.Quit(quitMsg, nil)
 	target.destroy(nil)
 	return false
@@ -1491,16 +1707,7 @@ func klineHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respon
 
 	// if they say LIST, we just list the current klines
 	if len(msg.Params) == currentArg+1 && strings.ToLower(msg.Params[currentArg]) == "list" {
-		bans := server.klines.AllBans()
-
-		if len(bans) == 0 {
-			client.Notice("No KLINEs have been set!")
-		}
-
-		for key, info := range bans {
-			client.Notice(formatBanForListing(client, key, info))
-		}
-
+		listBans(client, server.klines.AllBans(), client.t("No KLINEs have been set!"), rb)
 		return false
 	}
 
@@ -1570,6 +1777,10 @@ func klineHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respon
 	// get comment(s)
 	reason, operReason := getReasonsFromParams(msg.Params, currentArg)
 
+	if !server.checkOperActionLimit(client, "KLINE", rb) {
+		return false
+	}
+
 	err = server.klines.AddMask(mask, duration, reason, operReason, operName)
 	if err != nil {
 		rb.Notice(fmt.Sprintf(client.t("Could not successfully save new K-LINE: %s"), err.Error()))
@@ -1578,7 +1789,7 @@ func klineHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respon
 
 	var snoDescription string
 	if duration != 0 {
-		rb.Notice(fmt.Sprintf(client.t("Added temporary (%[1]s) K-Line for %[2]s"), duration.String(), mask))
+		rb.Notice(fmt.Sprintf(client.t("Added temporary (%[1]s) K-Line for %[2]s"), client.formatDuration(duration), mask))
 		snoDescription = fmt.Sprintf(ircfmt.Unescape("%s [%s]$r added temporary (%s) K-Line for %s"), details.nick, operName, duration.String(), mask)
 	} else {
 		rb.Notice(fmt.Sprintf(client.t("Added K-Line for %s"), mask))
@@ -1601,7 +1812,9 @@ func klineHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respon
 			}
 		}
 
+		nickDelay := server.Config().Server.NickDelay
 		for _, mcl := range clientsToKill {
+			server.clients.DelayNick(mcl, nickDelay)
 			mcl.Quit(fmt.Sprintf(mcl.t("You have been banned from this server (%s)"), reason), nil)
 			if mcl == client {
 				killClient = true
@@ -1686,9 +1899,9 @@ func listHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 	// get channels
 	var channels []string
 	for _, param := range msg.Params {
-		if 0 < len(param) && param[0] == '#' {
+		if isChannelName(param) {
 			for _, channame := range strings.Split(param, ",") {
-				if 0 < len(channame) && channame[0] == '#' {
+				if isChannelName(channame) {
 					channels = append(channels, channame)
 				}
 			}
@@ -1720,6 +1933,14 @@ func listHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 			matcher.MinClientsActive = true
 			matcher.MinClients = val + 1 // +1 because > means more than the given number
 		}
+		if key, value, found := strings.Cut(param, "="); found {
+			switch strings.ToLower(key) {
+			case "lang":
+				matcher.Language = strings.ToLower(value)
+			case "category":
+				matcher.Category = strings.ToLower(value)
+			}
+		}
 	}
 
 	nick := client.Nick()
@@ -1766,7 +1987,7 @@ func lusersHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respo
 
 // MODE <target> [<modestring> [<mode arguments>...]]
 func modeHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
-	if 0 < len(msg.Params[0]) && msg.Params[0][0] == '#' {
+	if isChannelName(msg.Params[0]) {
 		return cmodeHandler(server, client, msg, rb)
 	}
 	return umodeHandler(server, client, msg, rb)
@@ -2225,6 +2446,15 @@ func messageHandler(server *Server, client *Client, msg ircmsg.Message, rb *Resp
 		return false
 	}
 
+	if histType != history.Tagmsg {
+		if reason := dccSendBlocked(server.Config(), client, message); reason != "" {
+			if histType != history.Notice {
+				rb.Notice(reason)
+			}
+			return false
+		}
+	}
+
 	for i, targetString := range targets {
 		// max of four targets per privmsg
 		if i == maxTargets {
@@ -2247,6 +2477,32 @@ func messageHandler(server *Server, client *Client, msg ircmsg.Message, rb *Resp
 	return false
 }
 
+// dccSendBlocked checks a message against the DCC SEND policy, returning
+// the reason if it must be blocked
+func dccSendBlocked(config *Config, client *Client, message string) (reason string) {
+	dcc := &config.Server.DCC
+	if !(dcc.BlockSend || dcc.RequireAccount || len(dcc.BlockedExtensions) != 0) {
+		return ""
+	}
+	filename, isSend := utils.ParseDCCSend(message)
+	if !isSend {
+		return ""
+	}
+	if dcc.BlockSend {
+		return client.t("File transfers (DCC SEND) are disabled on this server")
+	}
+	if dcc.RequireAccount && client.Account() == "" {
+		return client.t("You must be logged into an account to send files (DCC SEND)")
+	}
+	lowerFilename := strings.ToLower(filename)
+	for _, extension := range dcc.BlockedExtensions {
+		if strings.HasSuffix(lowerFilename, "."+strings.ToLower(strings.TrimPrefix(extension, "."))) {
+			return fmt.Sprintf(client.t("Files of that type (%s) cannot be sent"), extension)
+		}
+	}
+	return ""
+}
+
 func dispatchMessageToTarget(client *Client, tags map[string]string, histType history.ItemType, command, target string, message utils.SplitMessage, rb *ResponseBuffer) {
 	server := client.server
 
@@ -2255,7 +2511,7 @@ func dispatchMessageToTarget(client *Client, tags map[string]string, histType hi
 
 	if len(target) == 0 {
 		return
-	} else if target[0] == '#' {
+	} else if isChannelName(target) {
 		channel := server.channels.Get(target)
 		if channel == nil {
 			if histType != history.Notice {
@@ -2263,7 +2519,7 @@ func dispatchMessageToTarget(client *Client, tags map[string]string, histType hi
 			}
 			return
 		}
-		channel.SendSplitMessage(command, lowestPrefix, tags, client, message, rb)
+		channel.sendSplitMessageAndPreview(command, histType, lowestPrefix, tags, client, message, rb)
 	} else if target[0] == '$' && len(target) > 2 && client.Oper().HasRoleCapab("massmessage") {
 		details := client.Details()
 		matcher, err := utils.CompileGlob(target[2:], false)
@@ -2438,19 +2694,31 @@ func npcaHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 	return false
 }
 
-// OPER <name> [password]
+// OPER <name> [password] [code]
 func operHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
 	if client.HasMode(modes.Operator) {
 		rb.Add(nil, server.name, ERR_UNKNOWNERROR, client.Nick(), "OPER", client.t("You're already opered-up!"))
 		return false
 	}
 
+	ipKey, operKey := server.lockoutKeyIP(client.IP()), lockoutKeyOper(msg.Params[0])
+	if remainingTime := server.checkLoginLockout(ipKey); remainingTime != 0 {
+		rb.Add(nil, server.name, ERR_PASSWDMISMATCH, client.Nick(), client.t((&ThrottleError{remainingTime}).Error()))
+		return false
+	}
+	server.throttleLogin(operKey)
+
 	// must pass at least one check, and all enabled checks
 	var checkPassed, checkFailed, passwordFailed bool
 	oper := server.GetOperator(msg.Params[0])
+	if oper == nil && len(msg.Params) > 1 {
+		// compare against a dummy hash, so the time taken doesn't reveal
+		// whether the operator block exists
+		passwd.CheckMissingConfigPassword(server.Config().operPassCost, []byte(msg.Params[1]))
+	}
 	if oper != nil {
 		if oper.Certfp != "" {
-			if oper.Certfp == rb.session.certfp {
+			if utils.CertfpsMatch(oper.Certfp, rb.session.certfp) {
 				checkPassed = true
 			} else {
 				checkFailed = true
@@ -2459,19 +2727,35 @@ func operHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 		if !checkFailed && oper.Pass != nil {
 			if len(msg.Params) == 1 {
 				checkFailed = true
-			} else if bcrypt.CompareHashAndPassword(oper.Pass, []byte(msg.Params[1])) != nil {
+			} else if !passwd.CheckConfigPassword(oper.Pass, []byte(msg.Params[1])) {
 				checkFailed = true
 				passwordFailed = true
 			} else {
 				checkPassed = true
 			}
 		}
+		// if the oper block is enrolled in TOTP, the code follows the password (if any)
+		if checkPassed && !checkFailed {
+			codeIndex := 1
+			if oper.Pass != nil {
+				codeIndex = 2
+			}
+			var code string
+			if codeIndex < len(msg.Params) {
+				code = msg.Params[codeIndex]
+			}
+			if server.CheckTwoFactor(fmt.Sprintf(keyOperTOTP, oper.Name), code) != nil {
+				checkFailed = true
+				passwordFailed = true
+			}
+		}
 	}
 
 	if !checkPassed || checkFailed {
 		rb.Add(nil, server.name, ERR_PASSWDMISMATCH, client.Nick(), client.t("Password incorrect"))
 		// #951: only disconnect them if we actually tried to check a password for them
 		if passwordFailed {
+			server.loginFailed(client, sno.LocalOpers, ipKey, operKey)
 			client.Quit(client.t("Password incorrect"), rb.session)
 			return true
 		} else {
@@ -2480,6 +2764,7 @@ func operHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 	}
 
 	if oper != nil {
+		server.loginSucceeded(operKey)
 		applyOper(client, oper, rb)
 	}
 	return false
@@ -2523,6 +2808,33 @@ func applyOper(client *Client, oper *Oper, rb *ResponseBuffer) {
 	}
 }
 
+// OPERTOTP <ENABLE | VERIFY <code> | DISABLE <code>>
+func opertotpHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	oper := client.Oper()
+	if oper == nil {
+		rb.Add(nil, server.name, ERR_NOPRIVILEGES, client.Nick(), client.t("Permission Denied"))
+		return false
+	}
+	twoFactorCommand(client, fmt.Sprintf(keyOperTOTP, oper.Name), oper.Name, msg.Params, rb.Notice)
+	return false
+}
+
+// expireOper removes a client's operator status without a request from the client,
+// e.g., after a period of inactivity
+func (client *Client) expireOper(reason string) {
+	oper := client.Oper()
+	applied := ApplyUserModeChanges(client, modes.ModeChanges{{Mode: modes.Operator, Op: modes.Remove}}, true, nil)
+	if len(applied) == 0 || oper == nil {
+		return
+	}
+	details := client.Details()
+	args := append([]string{details.nick}, applied.Strings()...)
+	client.Send(nil, details.nickMask, "MODE", args...)
+	client.Notice(client.t("Your operator status has expired; use /OPER to regain it"))
+	client.server.logger.Info("opers", details.nick, "was deopered as", oper.Name, "due to", reason)
+	client.server.snomasks.Send(sno.LocalOpers, fmt.Sprintf(ircfmt.Unescape("Client $c[grey][$r%[1]s$c[grey]] was deopered due to %[2]s"), details.nickMask, reason))
+}
+
 // DEOPER
 func deoperHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
 	if client.Oper() == nil {
@@ -2596,8 +2908,10 @@ func passHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 		return false
 	}
 
-	// check the provided password
-	if bcrypt.CompareHashAndPassword(serverPassword, []byte(password)) == nil {
+	// check the provided password, unless their IP is locked out
+	if server.checkLoginLockout(server.lockoutKeyIP(client.IP())) != 0 {
+		rb.session.passStatus = serverPassFailed
+	} else if passwd.CheckConfigPassword(serverPassword, []byte(password)) {
 		rb.session.passStatus = serverPassSuccessful
 	} else {
 		rb.session.passStatus = serverPassFailed
@@ -2680,7 +2994,7 @@ func redactHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respo
 	details := client.Details()
 	isBot := client.HasMode(modes.Bot)
 
-	if target[0] == '#' {
+	if isChannelName(target) {
 		channel := server.channels.Get(target)
 		if channel == nil {
 			rb.Add(nil, server.name, ERR_NOSUCHCHANNEL, client.Nick(), utils.SafeErrorParam(target), client.t("No such channel"))
@@ -2725,7 +3039,7 @@ func redactHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respo
 		return false
 	}
 
-	if target[0] != '#' {
+	if !isChannelName(target) {
 		// If this is a PM, we just removed the message from the buffer of the other party;
 		// now we have to remove it from the buffer of the client who sent the REDACT command
 		err := server.DeleteMessage(client.Nick(), targetmsgid, accountName)
@@ -2793,7 +3107,7 @@ func pingHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 
 // PONG [params...]
 func pongHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
-	// client gets touched when they send this command, so we don't need to do anything
+	client.Pong(rb.session)
 	return false
 }
 
@@ -2980,12 +3294,12 @@ func rehashHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respo
 	nick := client.Nick()
 	server.logger.Info("server", "REHASH command used by", nick)
 	err := server.rehash()
+	server.announceRehash(nick, err)
 
 	if err == nil {
 		// we used to send RPL_REHASHING here but i don't think it really makes sense
 		// in the labeled-response world, since the intent is "rehash in progress" but
 		// it won't display until the rehash is actually complete
-		// TODO all operators should get a notice of some kind here
 		rb.Notice(client.t("Rehash complete"))
 	} else {
 		rb.Add(nil, server.name, ERR_UNKNOWNERROR, nick, "REHASH", ircutils.SanitizeText(err.Error(), 350))
@@ -2993,6 +3307,16 @@ func rehashHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respo
 	return false
 }
 
+// RESTART [reason]
+func restartHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	if runtime.GOOS == "windows" {
+		rb.Add(nil, server.name, "FAIL", "RESTART", "UNSUPPORTED", client.t("RESTART is not supported on this platform; use DIE and restart the service instead"))
+		return false
+	}
+	operShutdown(server, client, msg, true, rb)
+	return false
+}
+
 // RELAYMSG <channel> <spoofed nick> :<message>
 func relaymsgHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) (result bool) {
 	config := server.Config()
@@ -3182,6 +3506,63 @@ func renameHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respo
 	return false
 }
 
+// REPORT <nick | channel> <reason>
+func reportHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	config := server.Config()
+	staffChannel := server.channels.Get(config.Server.Reports.Channel)
+	if !config.Server.Reports.Enabled || staffChannel == nil {
+		rb.Add(nil, server.name, "FAIL", "REPORT", "DISABLED", client.t("Reports are not enabled on this server"))
+		return false
+	}
+
+	// normalize the target's name, and make sure it exists
+	target := msg.Params[0]
+	if channel := server.channels.Get(target); channel != nil {
+		target = channel.Name()
+	} else if targetClient := server.clients.Get(target); targetClient != nil {
+		target = targetClient.Nick()
+	} else {
+		rb.Add(nil, server.name, "FAIL", "REPORT", "INVALID_TARGET", utils.SafeErrorParam(target), client.t("No such nick or channel"))
+		return false
+	}
+	reason := msg.Params[1]
+
+	if throttled, remainingTime := client.checkReportThrottle(config); throttled {
+		rb.Add(nil, server.name, "FAIL", "REPORT", "RATE_LIMITED", fmt.Sprintf(client.t("You have sent too many reports recently; try again in %v"), remainingTime.Round(time.Second)))
+		return false
+	}
+
+	details := client.Details()
+	report := []string{fmt.Sprintf("REPORT from %s [%s] about %s: %s", details.nickMask, details.accountName, target, reason)}
+	// snapshot context, from the history the reporter could retrieve themselves
+	if limit := config.Server.Reports.HistoryLines; limit > 0 {
+		if _, sequence, err := server.GetHistorySequence(nil, client, target); err == nil && sequence != nil {
+			items, _ := sequence.Between(history.Selector{}, history.Selector{}, limit)
+			for _, item := range items {
+				if item.Type != history.Privmsg && item.Type != history.Notice {
+					continue
+				}
+				message := item.Message.Message
+				if len(item.Message.Split) != 0 {
+					message = item.Message.Split[0].Message + " [...]"
+				}
+				report = append(report, fmt.Sprintf("  [%s] <%s> %s", item.Message.Time.Format(IRCv3TimestampFormat), NUHToNick(item.Nick), message))
+			}
+		}
+	}
+
+	for _, line := range report {
+		server.logger.Info("reports", line)
+		for _, member := range staffChannel.Members() {
+			for _, session := range member.Sessions() {
+				session.Send(nil, server.name, "NOTICE", staffChannel.Name(), line)
+			}
+		}
+	}
+	rb.Notice(client.t("Thank you, your report has been sent to the staff"))
+	return false
+}
+
 // SANICK <oldnick> <nickname>
 func sanickHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
 	targetNick := msg.Params[0]
@@ -3233,6 +3614,224 @@ func setnameHandler(server *Server, client *Client, msg ircmsg.Message, rb *Resp
 	return false
 }
 
+// STAFF [ON | OFF]
+func staffHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	if len(msg.Params) != 0 {
+		if client.Oper() == nil {
+			rb.Add(nil, server.name, ERR_NOPRIVILEGES, client.Nick(), client.t("Permission Denied"))
+			return false
+		}
+		switch strings.ToLower(msg.Params[0]) {
+		case "on":
+			client.SetStaffListed(true)
+			rb.Notice(client.t("You are now listed in STAFF"))
+		case "off":
+			client.SetStaffListed(false)
+			rb.Notice(client.t("You are no longer listed in STAFF"))
+		default:
+			rb.Notice(client.t("Invalid parameters"))
+		}
+		return false
+	}
+
+	// only opers who opted in are listed, so this reveals oper status even for
+	// hidden opers; opting in is their choice
+	var staff []*Client
+	for _, target := range server.clients.AllClients() {
+		if target.StaffListed() {
+			staff = append(staff, target)
+		}
+	}
+	if len(staff) == 0 {
+		rb.Notice(client.t("No staff are currently available; please try again later"))
+		return false
+	}
+	sort.Slice(staff, func(i, j int) bool { return staff[i].NickCasefolded() < staff[j].NickCasefolded() })
+	rb.Notice(client.t("The following staff are available to help:"))
+	for _, target := range staff {
+		line := target.Nick()
+		if oper := target.Oper(); oper != nil && oper.WhoisLine != "" {
+			line = fmt.Sprintf("%s (%s)", line, oper.WhoisLine)
+		}
+		if away, _ := target.Away(); away {
+			line = fmt.Sprintf(client.t("%s [away]"), line)
+		}
+		rb.Notice(line)
+	}
+	return false
+}
+
+// STATS <query>
+func statsHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	nick := client.Nick()
+	query := msg.Params[0]
+	config := server.Config()
+	server.snomasks.Send(sno.Stats, fmt.Sprintf(ircfmt.Unescape("STATS $c[grey][$r%s$c[grey]] requested by $c[grey][$r%s$c[grey]]"), query, client.NickMaskString()))
+	switch query {
+	case "c", "C":
+		// listeners, in lieu of connect blocks
+		addrs := make([]string, 0, len(config.Server.trueListeners))
+		for addr := range config.Server.trueListeners {
+			addrs = append(addrs, addr)
+		}
+		sort.Strings(addrs)
+		for _, addr := range addrs {
+			lconf := config.Server.trueListeners[addr]
+			var flags []string
+			if lconf.TLSConfig != nil {
+				flags = append(flags, "tls")
+			}
+			if lconf.RequireProxy {
+				flags = append(flags, "proxy")
+			}
+			if lconf.WebSocket {
+				flags = append(flags, "websocket")
+			}
+			if lconf.Tor {
+				flags = append(flags, "tor")
+			}
+			if lconf.STSOnly {
+				flags = append(flags, "sts-only")
+			}
+			if len(flags) == 0 {
+				flags = append(flags, "plaintext")
+			}
+			rb.Add(nil, server.name, RPL_STATSCLINE, nick, "C", addr, "*", strings.Join(flags, ","))
+		}
+	case "l", "L":
+		// per-connection traffic, optionally restricted to a single client
+		var targets []*Client
+		if len(msg.Params) > 1 {
+			if target := server.clients.Get(msg.Params[1]); target != nil {
+				targets = append(targets, target)
+			}
+		} else {
+			targets = server.clients.AllClients()
+		}
+		now := time.Now().UTC()
+		for _, target := range targets {
+			linkName := fmt.Sprintf("%s[%s]", target.Nick(), target.IPString())
+			for _, session := range target.Sessions() {
+				stats := session.socket.Stats()
+				rb.Add(nil, server.name, RPL_STATSLINKINFO, nick, linkName,
+					strconv.Itoa(stats.SendQ),
+					strconv.FormatUint(stats.LinesWritten, 10), strconv.FormatUint(stats.BytesWritten/1024, 10),
+					strconv.FormatUint(stats.LinesRead, 10), strconv.FormatUint(stats.BytesRead/1024, 10),
+					strconv.FormatInt(int64(now.Sub(session.ctime).Seconds()), 10))
+			}
+		}
+	case "p", "P":
+		// listeners, with their runtime status
+		for _, status := range server.ListenerStatuses() {
+			state := "closed"
+			if status.Open {
+				state = "open"
+			}
+			tls := "plaintext"
+			if status.Config.TLSConfig != nil {
+				tls = "tls"
+			}
+			kind := "stream"
+			if status.Config.WebSocket {
+				kind = "websocket"
+			}
+			rb.Add(nil, server.name, RPL_STATSDEBUG, nick, "P", fmt.Sprintf("%s %s %s %s active=%d accepted=%d",
+				status.Addr, kind, tls, state, status.Stats.Active, status.Stats.Accepted))
+		}
+	case "o", "O":
+		names := make([]string, 0, len(config.operators))
+		for name := range config.operators {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			oper := config.operators[name]
+			rb.Add(nil, server.name, RPL_STATSOLINE, nick, "O", "*", "*", oper.Name, oper.ClassName)
+		}
+	case "u", "U":
+		uptime := time.Since(server.ctime)
+		days := int(uptime.Hours()) / 24
+		uptime -= time.Duration(days) * 24 * time.Hour
+		rb.Add(nil, server.name, RPL_STATSUPTIME, nick, fmt.Sprintf(client.t("Server Up %[1]d days %[2]d:%02[3]d:%02[4]d"),
+			days, int(uptime.Hours()), int(uptime.Minutes())%60, int(uptime.Seconds())%60))
+	}
+
+	rb.Add(nil, server.name, RPL_ENDOFSTATS, nick, utils.SafeErrorParam(query), client.t("End of /STATS report"))
+	return false
+}
+
+// WALLOPS <message>
+func wallopsHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	message := msg.Params[0]
+	nickMask := client.NickMaskString()
+	for _, target := range server.clients.Filter(func(c *Client) bool { return c.HasMode(modes.WallOps) }) {
+		for _, session := range target.Sessions() {
+			session.Send(nil, nickMask, "WALLOPS", message)
+		}
+	}
+	server.logger.Info("opers", fmt.Sprintf("WALLOPS from %s: %s", client.Nick(), message))
+	return false
+}
+
+// GLOBOPS <message>
+// OPERWALL <message>
+func globopsHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	message := msg.Params[0]
+	nick := client.Nick()
+	for _, target := range server.clients.Filter(func(c *Client) bool { return c.HasMode(modes.Operator) }) {
+		target.Send(nil, server.name, "NOTICE", target.Nick(), fmt.Sprintf(target.t("*** Global -- from %[1]s: %[2]s"), nick, message))
+	}
+	server.logger.Info("opers", fmt.Sprintf("%s from %s: %s", msg.Command, nick, message))
+	return false
+}
+
+// LISTENER <OPEN | CLOSE> <address>
+func listenerHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	subcommand := strings.ToUpper(msg.Params[0])
+	addr := msg.Params[1]
+
+	var err error
+	var state string
+	switch subcommand {
+	case "OPEN":
+		err = server.OpenListener(addr)
+		state = "open"
+	case "CLOSE":
+		err = server.CloseListener(addr)
+		state = "closed"
+	default:
+		rb.Add(nil, server.name, "FAIL", "LISTENER", "UNKNOWN_COMMAND", utils.SafeErrorParam(msg.Params[0]), client.t("Unknown subcommand"))
+		return false
+	}
+	if err != nil {
+		rb.Add(nil, server.name, "FAIL", "LISTENER", "CANNOT_"+subcommand, utils.SafeErrorParam(addr), err.Error())
+		return false
+	}
+
+	rb.Notice(fmt.Sprintf(client.t("Listener %[1]s is now %[2]s"), addr, client.t(state)))
+	server.snomasks.Send(sno.LocalAnnouncements, fmt.Sprintf(ircfmt.Unescape("Operator $c[grey][$r%[1]s$c[grey]] set listener $c[grey][$r%[2]s$c[grey]] to %[3]s"), client.Oper().Name, addr, state))
+	return false
+}
+
+// LOADSTATUS
+func loadstatusHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	status := server.LoadStatus()
+
+	assessment := client.t("normal")
+	if status.SchedulerLag >= 100*time.Millisecond || status.SaturatedSessions != 0 {
+		assessment = client.t("elevated")
+	}
+	if status.SchedulerLag >= time.Second || status.MaxSendQFraction >= 0.9 {
+		assessment = client.t("overloaded")
+	}
+
+	rb.Notice(fmt.Sprintf(client.t("Load is %s"), assessment))
+	rb.Notice(fmt.Sprintf(client.t("Scheduler lag: %v (%d goroutines)"), status.SchedulerLag.Round(time.Microsecond), status.Goroutines))
+	rb.Notice(fmt.Sprintf(client.t("Memory: %d KiB of heap; last GC pause %v"), status.HeapBytes/1024, status.LastGCPause.Round(time.Microsecond)))
+	rb.Notice(fmt.Sprintf(client.t("Sendq: %d of %d sessions are at least half full; the fullest is %.0f%% full"), status.SaturatedSessions, status.Sessions, status.MaxSendQFraction*100))
+	return false
+}
+
 // SUMMON [parameters]
 func summonHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
 	rb.Add(nil, server.name, ERR_SUMMONDISABLED, client.Nick(), client.t("SUMMON has been disabled"))
@@ -3474,10 +4073,10 @@ func webircHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respo
 	for _, info := range server.Config().Server.WebIRC {
 		if utils.IPInNets(client.realIP, info.allowedNets) {
 			// confirm password and/or fingerprint
-			if 0 < len(info.Password) && bcrypt.CompareHashAndPassword(info.Password, givenPassword) != nil {
+			if 0 < len(info.Password) && !passwd.CheckConfigPassword(info.Password, givenPassword) {
 				continue
 			}
-			if info.Certfp != "" && info.Certfp != rb.session.certfp {
+			if info.Certfp != "" && !utils.CertfpsMatch(info.Certfp, rb.session.certfp) {
 				continue
 			}
 
@@ -3485,9 +4084,13 @@ func webircHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respo
 			if err != nil {
 				client.Quit(quitMsg, rb.session)
 				return true
-			} else {
-				return false
 			}
+			// optionally trust the gateway's hostname for the user, instead of
+			// doing our own lookup of the proxied IP
+			if info.AcceptHostname && utils.IsHostname(msg.Params[2]) && net.ParseIP(msg.Params[2]) == nil {
+				client.applyHostname(rb.session, msg.Params[2], true)
+			}
+			return false
 		}
 	}
 
@@ -3684,7 +4287,7 @@ func whoHandler(server *Server, client *Client, msg ircmsg.Message, rb *Response
 	var isBareNick bool
 	mask := origMask
 	var err error
-	if origMask[0] == '#' {
+	if isChannelName(origMask) {
 		mask, err = CasefoldChannel(origMask)
 		isChannel = true
 	} else if !strings.ContainsAny(origMask, protocolBreakingNameCharacters) {
@@ -3843,6 +4446,7 @@ func whoisHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respon
 			}
 			for mclient := range matches {
 				client.getWhoisOf(mclient, hasPrivs, rb)
+				client.notifyWhois(mclient)
 			}
 		}
 	} else {
@@ -3851,6 +4455,7 @@ func whoisHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respon
 		mclient := server.clients.Get(nick)
 		if mclient != nil {
 			client.getWhoisOf(mclient, hasPrivs, rb)
+			client.notifyWhois(mclient)
 		} else if !handleService(nick) {
 			rb.Add(nil, client.server.name, ERR_NOSUCHNICK, client.Nick(), utils.SafeErrorParam(masksString), client.t("No such nick"))
 		}
@@ -3884,6 +4489,7 @@ func whowasHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respo
 				if canSeeIP {
 					rb.Add(nil, server.name, RPL_WHOWASIP, cnick, whoWas.nick, fmt.Sprintf(client.t("was connecting from %s"), utils.IPStringToHostname(whoWas.ip.String())))
 				}
+				rb.Add(nil, server.name, RPL_WHOISSERVER, cnick, whoWas.nick, server.name, whoWas.time.Format(time.RFC1123))
 			}
 		}
 		rb.Add(nil, server.name, RPL_ENDOFWHOWAS, cnick, utils.SafeErrorParam(nickname), client.t("End of WHOWAS"))
@@ -56,6 +56,8 @@ Ergo supports the following channel modes:
   +t  |  Only channel opers can modify the topic.
   +E  |  Roleplaying commands are enabled in the channel.
   +C  |  Clients are blocked from sending CTCP messages in the channel.
+  +T  |  Clients below halfop are blocked from sending NOTICEs to the channel.
+  +A  |  Clients below halfop are blocked from sending ACTIONs (/me) to the channel.
   +u  |  Auditorium mode: JOIN, PART, QUIT, NAMES, and WHO are hidden
          from unvoiced clients.
   +U  |  Op-moderated mode: messages from unprivileged clients are sent
@@ -80,7 +82,10 @@ Ergo supports the following user modes:
   +Z  |  User is connected via TLS.
   +B  |  User is a bot.
   +E  |  User can receive roleplaying commands.
-  +T  |  CTCP messages to the user are blocked.`
+  +T  |  CTCP messages to the user are blocked.
+  +Y  |  Operator's WHOIS lookups are covert (not notified to the target, but logged).
+  +w  |  User receives WALLOPS messages.
+  +J  |  Joins, parts, and quits of unprivileged users in large channels are hidden.`
 	snomaskHelpText = `== Server Notice Masks ==
 
 Ergo supports the following server notice masks for operators:
@@ -121,6 +126,18 @@ applicable restriction is the +R registered-only mode.`,
 		text: `AMBIANCE <target> <text to be sent>
 
 The AMBIANCE command is used to send a scene notification to the given target.`,
+	},
+	"apitoken": {
+		oper: true,
+		text: `APITOKEN CREATE <name> <scope>[,<scope>...]
+APITOKEN LIST
+APITOKEN REVOKE <name>
+
+Manages tokens for the administrative endpoints of the HTTP API, so that
+automation doesn't need to share a token from the config file. Each scope is
+the name of an endpoint (channel_history, accounts, registered_channels, or
+metrics), or "all". CREATE displays the new token once; only a hash of it
+is stored.`,
 	},
 	"authenticate": {
 		text: `AUTHENTICATE
@@ -153,6 +170,20 @@ http://ircv3.net/specs/core/capability-negotiation-3.2.html`,
 CHATHISTORY is a history replay command associated with the IRCv3
 chathistory extension. See this document:
 https://ircv3.net/specs/extensions/chathistory`,
+	},
+	"connexempt": {
+		oper: true,
+		text: `CONNEXEMPT <subcommand> [arguments]
+
+Manages exemptions from the connection limits and throttle (see the
+ip-limits config block). Accepts the following subcommands:
+
+1. CONNEXEMPT ADD <ip/cidr> [DURATION <duration>]
+2. CONNEXEMPT DEL <ip/cidr>
+3. CONNEXEMPT LIST
+
+These exemptions are lost on restart; permanent exemptions should be added
+to the 'exempted' list in the config file.`,
 	},
 	"debug": {
 		oper: true,
@@ -164,8 +195,11 @@ Provides various debugging commands for the IRCd. <option> can be one of:
 * NUMGOROUTINE: Number of goroutines in use.
 * STARTCPUPROFILE: Starts the CPU profiler.
 * STOPCPUPROFILE: Stops the CPU profiler.
+* CPUPROFILE <seconds>: Runs the CPU profiler for the given number of seconds.
 * PROFILEHEAP: Writes a memory profile.
-* CRASHSERVER: Crashes the server (for use in failover testing)`,
+* CRASHSERVER: Crashes the server (for use in failover testing)
+
+Profiles are written to server.output-path, with timestamped filenames.`,
 	},
 	"defcon": {
 		oper: true,
@@ -187,6 +221,13 @@ spam or other hostile activity. It has five levels, which are cumulative
 		text: `DEOPER
 
 DEOPER removes the IRCop privileges granted to you by a successful /OPER.`,
+	},
+	"die": {
+		oper: true,
+		text: `DIE [reason]
+
+Shuts down the server: listeners are closed, clients are disconnected with an
+ERROR explaining why, and state is saved before the process exits.`,
 	},
 	"dline": {
 		oper: true,
@@ -224,6 +265,12 @@ To remove a DLINE, use the "UNDLINE" command.`,
 		text: `EXTJWT <target> [service_name]
 
 Get a JSON Web Token for target (either * or a channel name).`,
+	},
+	"globops": {
+		oper: true,
+		text: `GLOBOPS <message>
+
+Sends a notice to all operators on the server. OPERWALL is an alias.`,
 	},
 	"help": {
 		text: `HELP <argument>
@@ -251,9 +298,11 @@ Sends information about the server, developers, etc.`,
 	},
 	"invite": {
 		text: `INVITE <nickname> <channel>
+INVITE
 
 Invites the given user to the given channel, so long as you have the
-appropriate channel privs.`,
+appropriate channel privs. With no parameters, lists the channels you have
+been invited to and can still join.`,
 	},
 	"ison": {
 		text: `ISON <nickname>{ <nickname>}
@@ -318,8 +367,33 @@ Sets your preferred languages to the given ones.`,
 		text: `LIST [<channel>{,<channel>}] [<elistcond>{,<elistcond>}]
 
 Shows information on the given channels (or if none are given, then on all
-channels). <elistcond>s modify how the channels are selected.`,
-		//TODO(dan): Explain <elistcond>s in more specific detail
+channels). <elistcond>s modify how the channels are selected:
+
+  >N            channels with more than N users
+  <N            channels with fewer than N users
+  lang=<tag>    channels whose language (see /CS HELP SET) matches <tag>
+  category=<c>  channels whose category (see /CS HELP SET) is <c>
+
+The supported conditions are advertised in the ELIST token of RPL_ISUPPORT
+(005): U for >N and <N, L for lang=, and G for category=.`,
+	},
+	"listener": {
+		oper: true,
+		text: `LISTENER <OPEN | CLOSE> <address>
+
+Stops or resumes accepting new connections on one of the configured
+listeners, without affecting existing connections. The configured listeners
+and their addresses can be seen with /STATS p. All configured listeners are
+opened again on rehash.`,
+	},
+	"loadstatus": {
+		oper: true,
+		text: `LOADSTATUS
+
+Summarizes signs that the server is overloaded: how long goroutines wait to
+be scheduled, memory use, and how many connections have sendqs that are
+filling up. The same values are available to monitoring systems as gauges
+at the API's /v1/metrics endpoint.`,
 	},
 	"lusers": {
 		text: `LUSERS [<mask> [<server>]]
@@ -399,9 +473,30 @@ The NPC command is used to send an action to the target as the source.
 Requires the roleplay mode (+E) to be set on the target.`,
 	},
 	"oper": {
-		text: `OPER <name> [password]
+		text: `OPER <name> [password] [code]
 
-If the correct details are given, gives you IRCop privs.`,
+If the correct details are given, gives you IRCop privs. If the operator block
+is enrolled in two-factor authentication (see OPERTOTP), the current code from
+your authenticator app (or a recovery code) must follow the password.`,
+	},
+	"opertotp": {
+		oper: true,
+		text: `OPERTOTP <subcommand> [code]
+
+Manages two-factor authentication for your operator block. Accepts the
+following subcommands:
+
+1. OPERTOTP ENABLE: generates a secret to add to your authenticator app
+2. OPERTOTP VERIFY <code>: confirms the enrollment, displaying recovery codes
+3. OPERTOTP DISABLE <code>: disables two-factor authentication
+
+Once enabled, the code is required by /OPER.`,
+	},
+	"operwall": {
+		oper: true,
+		text: `OPERWALL <message>
+
+Sends a notice to all operators on the server. An alias for GLOBOPS.`,
 	},
 	"part": {
 		text: `PART <channel>{,<channel>} [reason]
@@ -459,6 +554,13 @@ Renames the given channel with the given reason, if possible.
 
 For example:
 	RENAME #ircv2 #ircv3 :Protocol upgrades!`,
+	},
+	"report": {
+		text: `REPORT <nick | channel> <reason>
+
+REPORT sends a report about the given user or channel to the server staff,
+e.g., to report spam or abuse. Recent messages that you could retrieve
+yourself with CHATHISTORY may be included with the report.`,
 	},
 	"sajoin": {
 		oper: true,
@@ -490,6 +592,28 @@ The SCENE command is used to send a scene notification to the given target.`,
 		text: `SETNAME <realname>
 
 The SETNAME command updates the realname to be the newly-given one.`,
+	},
+	"staff": {
+		text: `STAFF [ON | OFF]
+
+STAFF lists the server operators who are available to help. Operators can
+add or remove themselves from the list with STAFF ON and STAFF OFF.`,
+	},
+	"stats": {
+		oper: true,
+		text: `STATS <query> [nick]
+
+Shows server statistics. Supported queries are:
+
+c - the configured listeners
+l - per-connection traffic (sendq, messages and KiB sent, messages and KiB
+    received, seconds connected), for everyone or for [nick]
+o - the configured operator blocks
+p - the configured listeners, whether they are open, and how many
+    connections they have (active and accepted in total)
+u - the server's uptime
+
+STATS requires the 'ban' operator capability.`,
 	},
 	"summon": {
 		text: `SUMMON [parameters]
@@ -517,6 +641,13 @@ Registers an account in accordance with the draft/account-registration capabilit
 		text: `REHASH
 
 Reloads the config file and updates TLS certificates on listeners`,
+	},
+	"restart": {
+		oper: true,
+		text: `RESTART [reason]
+
+Shuts the server down as with DIE, then starts it again with the same
+executable and arguments (picking up a new binary, if it was replaced).`,
 	},
 	"time": {
 		text: `TIME [server]
@@ -592,6 +723,12 @@ Verifies an account in accordance with the draft/account-registration capability
 		text: `VERSION [server]
 
 Views the version of software and the RPL_ISUPPORT tokens for the given server.`,
+	},
+	"wallops": {
+		oper: true,
+		text: `WALLOPS <message>
+
+Sends a message to all users who have user mode +w set.`,
 	},
 	"webirc": {
 		oper: true, // not really, but it's restricted anyways
@@ -5,11 +5,15 @@ package irc
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/ergochat/ergo/irc/custime"
 	"github.com/ergochat/ergo/irc/history"
 	"github.com/ergochat/ergo/irc/modes"
 	"github.com/ergochat/ergo/irc/utils"
@@ -71,6 +75,23 @@ the request of the account holder.`,
 			minParams: 1,
 			maxParams: 1,
 		},
+		"archive": {
+			handler: histservArchiveHandler,
+			help: `Syntax: $bARCHIVE #channel [format] [start] [end]$b
+
+ARCHIVE exports the stored history of a channel to a file on the server,
+for retrieval by the server administrators. You must be the channel founder
+(or an operator with the 'history' capability). 'format' is either 'jsonl'
+(one JSON object per line, the default) or 'text'. 'start' and 'end' limit
+the export to a time range; each is either a timestamp (such as
+2006-01-02T15:04:05.000Z) or a duration ago (such as 7d). Channels whose
+history is restricted by a query cutoff cannot be archived, and only one
+archive can be written at a time.`,
+			helpShort: `$bARCHIVE$b exports a channel's stored history.`,
+			enabled:   histservEnabled,
+			minParams: 1,
+			maxParams: 4,
+		},
 		"play": {
 			handler: histservPlayHandler,
 			help: `Syntax: $bPLAY <target> [limit]$b
@@ -258,3 +279,211 @@ func easySelectHistory(server *Server, client *Client, params []string) (items [
 	}
 	return
 }
+
+// archiveFormat is an output format for channel history archives
+type archiveFormat uint
+
+const (
+	archiveFormatJSONL archiveFormat = iota
+	archiveFormatText
+)
+
+// how many items to request from the history store at a time while archiving
+const archiveBatchSize = 1000
+
+func archiveFormatFromString(str string) (result archiveFormat, err error) {
+	switch strings.ToLower(str) {
+	case "jsonl", "json":
+		return archiveFormatJSONL, nil
+	case "text", "txt":
+		return archiveFormatText, nil
+	default:
+		return archiveFormatJSONL, errInvalidParams
+	}
+}
+
+// parseArchiveTime parses a timestamp, or a duration to be subtracted from the current time
+func parseArchiveTime(str string) (result time.Time, err error) {
+	if duration, err := custime.ParseDuration(str); err == nil {
+		return time.Now().UTC().Add(-duration), nil
+	}
+	return time.Parse(IRCv3TimestampFormat, str)
+}
+
+// channelArchiveSequence returns the history of a channel, for privileged archival
+// access. The server-wide expire-time applies; if the channel's history is restricted
+// by a query cutoff (i.e., is only visible to some members), it cannot be archived.
+func (server *Server) channelArchiveSequence(channel *Channel) (sequence history.Sequence, err error) {
+	config := server.Config()
+	var cutoff time.Time
+	if config.History.Restrictions.ExpireTime != 0 {
+		cutoff = time.Now().UTC().Add(-time.Duration(config.History.Restrictions.ExpireTime))
+	}
+	status, target, restriction := channel.historyStatus(config)
+	if restriction != HistoryCutoffNone {
+		return nil, errInsufficientPrivs
+	}
+	switch status {
+	case HistoryEphemeral:
+		return channel.history.MakeSequence("", cutoff), nil
+	case HistoryPersistent:
+		return server.historyDB.MakeSequence(target, "", cutoff), nil
+	default:
+		return nil, errNoop
+	}
+}
+
+type archiveItem struct {
+	Time    time.Time `json:"time"`
+	Msgid   string    `json:"msgid,omitempty"`
+	Type    string    `json:"type"`
+	Nick    string    `json:"nick"`
+	Account string    `json:"account,omitempty"`
+	Message string    `json:"message"`
+}
+
+// writeChannelArchive writes the messages from a channel's history between
+// `start` and `end` (either of which may be zero) to `writer`, oldest first.
+func writeChannelArchive(sequence history.Sequence, start, end time.Time, format archiveFormat, writer io.Writer) (count int, err error) {
+	// both bounds must be nonzero, so that each page is a forward BETWEEN query
+	// (with a zero start, Between would return the newest items instead)
+	after := history.Selector{Time: start}
+	if start.IsZero() {
+		after.Time = time.Unix(0, 0).UTC()
+	}
+	before := history.Selector{Time: end}
+	if end.IsZero() {
+		before.Time = time.Now().UTC().Add(time.Minute)
+	}
+	encoder := json.NewEncoder(writer)
+
+	writeLine := func(item *history.Item, message string) error {
+		switch format {
+		case archiveFormatText:
+			_, err := fmt.Fprintf(writer, "[%s] <%s> %s\n", item.Message.Time.Format(IRCv3TimestampFormat), NUHToNick(item.Nick), message)
+			return err
+		default:
+			itemType := "PRIVMSG"
+			if item.Type == history.Notice {
+				itemType = "NOTICE"
+			}
+			account := item.AccountName
+			if account == "*" {
+				account = ""
+			}
+			return encoder.Encode(archiveItem{
+				Time:    item.Message.Time,
+				Msgid:   item.Message.Msgid,
+				Type:    itemType,
+				Nick:    NUHToNick(item.Nick),
+				Account: account,
+				Message: message,
+			})
+		}
+	}
+
+	for {
+		items, err := sequence.Between(after, before, archiveBatchSize)
+		if err != nil {
+			return count, err
+		}
+		for i := range items {
+			item := &items[i]
+			if item.Type != history.Privmsg && item.Type != history.Notice {
+				continue
+			}
+			if len(item.Message.Split) == 0 {
+				err = writeLine(item, item.Message.Message)
+			} else {
+				for _, pair := range item.Message.Split {
+					if err = writeLine(item, pair.Message); err != nil {
+						break
+					}
+				}
+			}
+			if err != nil {
+				return count, err
+			}
+			count++
+		}
+		if len(items) < archiveBatchSize {
+			return count, nil
+		}
+		after = history.Selector{Msgid: items[len(items)-1].Message.Msgid, Time: items[len(items)-1].Message.Time}
+	}
+}
+
+func histservArchiveHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
+	channel := server.channels.Get(params[0])
+	if channel == nil {
+		service.Notice(rb, client.t("No such channel"))
+		return
+	}
+	account := client.Account()
+	if !((account != "" && account == channel.Founder()) || client.HasRoleCapabs("history")) {
+		service.Notice(rb, client.t("Insufficient privileges"))
+		return
+	}
+
+	var err error
+	format := archiveFormatJSONL
+	var start, end time.Time
+	if len(params) > 1 {
+		format, err = archiveFormatFromString(params[1])
+	}
+	if err == nil && len(params) > 2 {
+		start, err = parseArchiveTime(params[2])
+	}
+	if err == nil && len(params) > 3 {
+		end, err = parseArchiveTime(params[3])
+	}
+	if err != nil {
+		service.Notice(rb, client.t("Invalid parameters"))
+		return
+	}
+
+	sequence, err := server.channelArchiveSequence(channel)
+	if err == errInsufficientPrivs {
+		service.Notice(rb, client.t("History for that channel is restricted and cannot be archived"))
+		return
+	} else if err != nil {
+		service.Notice(rb, client.t("History is not enabled for that channel"))
+		return
+	}
+	if !server.archiveInProgress.CompareAndSwap(false, true) {
+		service.Notice(rb, client.t("Another archive is already being written; try again later"))
+		return
+	}
+
+	extension := "jsonl"
+	if format == archiveFormatText {
+		extension = "txt"
+	}
+	// as with EXPORT, don't include the channel name in the filename because of escaping concerns
+	filename := fmt.Sprintf("%s-%s.%s", utils.GenerateSecretToken(), time.Now().UTC().Format(IRCv3TimestampFormat), extension)
+	outfile, err := os.Create(server.Config().getOutputPath(filename))
+	if err != nil {
+		server.archiveInProgress.Store(false)
+		service.Notice(rb, fmt.Sprintf(client.t("Error opening export file: %v"), err))
+		return
+	}
+	chname := channel.Name()
+	service.Notice(rb, fmt.Sprintf(client.t("Started archiving history for channel %[1]s to file %[2]s"), chname, filename))
+
+	go func() {
+		defer server.HandlePanic()
+		defer server.archiveInProgress.Store(false)
+
+		defer outfile.Close()
+		writer := bufio.NewWriter(outfile)
+		defer writer.Flush()
+
+		count, err := writeChannelArchive(sequence, start, end, format, writer)
+		if err != nil {
+			server.logger.Error("history", "couldn't archive channel history", chname, err.Error())
+		}
+		if target := server.clients.Get(client.Nick()); target == client {
+			client.Send(nil, service.prefix, "NOTICE", client.Nick(), fmt.Sprintf(client.t("Archived %[1]d messages from %[2]s to %[3]s"), count, chname, filename))
+		}
+	}()
+}
@@ -0,0 +1,40 @@
+package irc
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ergochat/ergo/irc/history"
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+func TestWriteChannelArchive(t *testing.T) {
+	const numItems = 2*archiveBatchSize + 500
+	buf := history.NewHistoryBuffer(numItems, 0)
+	start := time.Now().UTC().Add(-time.Hour)
+	for i := 0; i < numItems; i++ {
+		buf.Add(history.Item{
+			Type: history.Privmsg,
+			Nick: "alice!alice@localhost",
+			Message: utils.SplitMessage{
+				Message: fmt.Sprintf("message %d", i),
+				Msgid:   fmt.Sprintf("msgid%d", i),
+				Time:    start.Add(time.Duration(i) * time.Millisecond),
+			},
+		})
+	}
+
+	var out bytes.Buffer
+	count, err := writeChannelArchive(buf.MakeSequence("", time.Time{}), time.Time{}, time.Time{}, archiveFormatText, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(count, numItems)
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	assertEqual(len(lines), numItems)
+	assertEqual(strings.HasSuffix(lines[0], "<alice> message 0"), true)
+	assertEqual(strings.HasSuffix(lines[numItems-1], fmt.Sprintf("<alice> message %d", numItems-1)), true)
+}
@@ -0,0 +1,235 @@
+// Package linkpreview fetches the titles of web pages linked in messages,
+// with protections against server-side request forgery.
+package linkpreview
+
+import (
+	"context"
+	"errors"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ergochat/irc-go/ircmsg"
+
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+var (
+	ErrForbiddenAddress = errors.New("URL resolves to a forbidden address")
+	ErrNotHTML          = errors.New("URL is not an HTML page")
+
+	urlRegexp   = regexp.MustCompile(`https?://[^\s\x00-\x1f<>"]+`)
+	titleRegexp = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+	// special-purpose ranges that aren't covered by the net.IP predicates
+	nonPublicNets = []net.IPNet{
+		mustParseCIDR("0.0.0.0/8"),      // "this network" (RFC 1122)
+		mustParseCIDR("100.64.0.0/10"),  // carrier-grade NAT (RFC 6598)
+		mustParseCIDR("192.0.0.0/24"),   // IETF protocol assignments (RFC 6890)
+		mustParseCIDR("198.18.0.0/15"),  // benchmarking (RFC 2544)
+		mustParseCIDR("240.0.0.0/4"),    // reserved, including broadcast (RFC 1112)
+		mustParseCIDR("64:ff9b::/96"),   // NAT64, which can embed any IPv4 address (RFC 6052)
+		mustParseCIDR("64:ff9b:1::/48"), // local-use NAT64 (RFC 8215)
+	}
+)
+
+const (
+	maxCacheEntries  = 4096
+	maxTitleLen      = 200
+	maxRedirects     = 3
+	concurrentGetMax = 8
+)
+
+type Config struct {
+	Enabled       bool
+	Timeout       time.Duration
+	MaxBytes      int           `yaml:"max-bytes"`
+	CacheDuration time.Duration `yaml:"cache-duration"`
+}
+
+type cacheEntry struct {
+	title   string
+	expires time.Time
+}
+
+// Previewer fetches and caches page titles. Only http and https URLs on the
+// default ports, resolving to public addresses, are fetched; the address
+// is checked at connection time, so DNS rebinding and redirects to internal
+// addresses are also refused.
+type Previewer struct {
+	sync.Mutex
+
+	config    Config
+	client    *http.Client
+	cache     map[string]cacheEntry
+	semaphore utils.Semaphore
+
+	// for testing against local servers
+	allowPrivate bool
+}
+
+func (p *Previewer) ApplyConfig(config Config) {
+	if config.Timeout == 0 {
+		config.Timeout = 5 * time.Second
+	}
+	if config.MaxBytes == 0 {
+		config.MaxBytes = 64 * 1024
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	p.config = config
+	if p.cache == nil {
+		p.cache = make(map[string]cacheEntry)
+		p.semaphore = utils.NewSemaphore(concurrentGetMax)
+	}
+	dialer := net.Dialer{
+		Timeout: config.Timeout,
+		Control: p.checkAddress,
+	}
+	p.client = &http.Client{
+		Timeout: config.Timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: config.Timeout,
+			DisableKeepAlives:   true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+}
+
+func (p *Previewer) checkAddress(network, address string, c syscall.RawConn) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if p.allowPrivate {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !IsPublicIP(ip) || !(port == "80" || port == "443") {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// IsPublicIP returns whether an IP is globally routable, i.e., whether it is
+// safe to connect to on behalf of a user.
+func IsPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() {
+		return false
+	}
+	for _, network := range nonPublicNets {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func mustParseCIDR(cidr string) net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return *network
+}
+
+// FindURL returns the first http or https URL in a message, or "".
+func FindURL(message string) string {
+	return urlRegexp.FindString(message)
+}
+
+// Title returns the title of the page at `url` (possibly from the cache),
+// or "" if it has none or couldn't be fetched. It blocks for up to the
+// configured timeout.
+func (p *Previewer) Title(url string) (title string) {
+	p.Lock()
+	config, client := p.config, p.client
+	entry, ok := p.cache[url]
+	p.Unlock()
+
+	now := time.Now()
+	if ok && now.Before(entry.expires) {
+		return entry.title
+	}
+	// don't let a burst of links tie up unlimited goroutines and sockets
+	if !p.semaphore.TryAcquire() {
+		return ""
+	}
+	defer p.semaphore.Release()
+
+	title, _ = fetchTitle(client, config, url)
+
+	p.Lock()
+	defer p.Unlock()
+	if len(p.cache) >= maxCacheEntries {
+		for key, entry := range p.cache {
+			if now.After(entry.expires) {
+				delete(p.cache, key)
+			}
+		}
+		if len(p.cache) >= maxCacheEntries {
+			p.cache = make(map[string]cacheEntry)
+		}
+	}
+	// failures are cached too, so that a broken link can't be used to
+	// make us repeatedly contact a server
+	p.cache[url] = cacheEntry{title: title, expires: now.Add(config.CacheDuration)}
+	return title
+}
+
+func fetchTitle(client *http.Client, config Config, url string) (title string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("User-Agent", "ergo link preview")
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		return "", ErrNotHTML
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(config.MaxBytes)))
+	if err != nil {
+		return
+	}
+	return extractTitle(body), nil
+}
+
+func extractTitle(body []byte) (title string) {
+	match := titleRegexp.FindSubmatch(body)
+	if match == nil {
+		return ""
+	}
+	title = strings.Join(strings.Fields(html.UnescapeString(string(match[1]))), " ")
+	title = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, title)
+	if len(title) > maxTitleLen {
+		title = ircmsg.TruncateUTF8Safe(title, maxTitleLen) + "..."
+	}
+	return
+}
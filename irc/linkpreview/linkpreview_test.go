@@ -0,0 +1,74 @@
+package linkpreview
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFindURL(t *testing.T) {
+	if url := FindURL("have you seen https://ergo.chat/about?x=1 yet"); url != "https://ergo.chat/about?x=1" {
+		t.Errorf("unexpected URL %q", url)
+	}
+	if url := FindURL("no links here, just ftp://example.com"); url != "" {
+		t.Errorf("unexpected URL %q", url)
+	}
+}
+
+func TestExtractTitle(t *testing.T) {
+	title := extractTitle([]byte("<html><head><TITLE>\n  Ergo &amp; friends\r\n</TITLE></head></html>"))
+	if title != "Ergo & friends" {
+		t.Errorf("unexpected title %q", title)
+	}
+	if title := extractTitle([]byte("<html><body>untitled</body></html>")); title != "" {
+		t.Errorf("unexpected title %q", title)
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1", "10.1.2.3", "192.168.0.1", "169.254.169.254", "100.64.0.1", "::1", "fe80::1", "fd00::1", "0.0.0.0",
+		"0.1.2.3", "192.0.0.170", "198.18.0.1", "240.0.0.1", "255.255.255.255", "64:ff9b::a00:1"} {
+		if IsPublicIP(net.ParseIP(addr)) {
+			t.Errorf("%s should not be public", addr)
+		}
+	}
+	for _, addr := range []string{"8.8.8.8", "2001:4860:4860::8888"} {
+		if !IsPublicIP(net.ParseIP(addr)) {
+			t.Errorf("%s should be public", addr)
+		}
+	}
+}
+
+func TestTitle(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, "<title>Test page</title>")
+	}))
+	defer server.Close()
+
+	var p Previewer
+	p.ApplyConfig(Config{Enabled: true, CacheDuration: time.Minute})
+	// the test server is on loopback, so it must be refused
+	if title := p.Title(server.URL); title != "" {
+		t.Errorf("fetched a loopback address: %q", title)
+	}
+	if hits != 0 {
+		t.Errorf("connected to a loopback address")
+	}
+
+	p = Previewer{allowPrivate: true}
+	p.ApplyConfig(Config{Enabled: true, CacheDuration: time.Minute})
+	for i := 0; i < 2; i++ {
+		if title := p.Title(server.URL); title != "Test page" {
+			t.Errorf("unexpected title %q", title)
+		}
+	}
+	if hits != 1 {
+		t.Errorf("expected the title to be cached, got %d requests", hits)
+	}
+}
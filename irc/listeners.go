@@ -17,7 +17,9 @@ import (
 )
 
 var (
-	errCantReloadListener = errors.New("can't switch a listener between stream and websocket")
+	errCantReloadListener  = errors.New("can't switch a listener between stream and websocket")
+	errNoSuchListener      = errors.New("no listener is configured on that address")
+	errListenerAlreadyOpen = errors.New("that listener is already open")
 )
 
 // IRCListener is an abstract wrapper for a listener (TCP port or unix domain socket).
@@ -25,6 +27,7 @@ var (
 type IRCListener interface {
 	Reload(config utils.ListenerConfig) error
 	Stop() error
+	Stats() utils.ListenerStats
 }
 
 // NewListener creates a new listener according to the specifications in the config file
@@ -87,6 +90,10 @@ func (nl *NetListener) Stop() error {
 	return nl.listener.Close()
 }
 
+func (nl *NetListener) Stats() utils.ListenerStats {
+	return nl.listener.Stats()
+}
+
 func (nl *NetListener) serve() {
 	for {
 		conn, err := nl.listener.Accept()
@@ -144,6 +151,10 @@ func (wl *WSListener) Stop() error {
 	return wl.httpServer.Close()
 }
 
+func (wl *WSListener) Stats() utils.ListenerStats {
+	return wl.listener.Stats()
+}
+
 func (wl *WSListener) handle(w http.ResponseWriter, r *http.Request) {
 	config := wl.server.Config()
 	remoteAddr := r.RemoteAddr
@@ -0,0 +1,59 @@
+package irc
+
+import (
+	"runtime"
+	"time"
+)
+
+const (
+	// a session whose sendq is at least this fraction of max-sendq is "saturated":
+	// it is falling behind and at risk of being disconnected
+	sendQSaturationThreshold = 0.5
+	// duration of the sleep used to estimate scheduler latency
+	schedulerProbeDuration = time.Millisecond
+)
+
+// LoadStatus is a snapshot of signals indicating that the server is overloaded.
+type LoadStatus struct {
+	// how much later than requested a short sleep woke up; high values mean
+	// that goroutines (i.e., client connections) are waiting to be scheduled
+	SchedulerLag time.Duration
+	Goroutines   int
+	HeapBytes    uint64
+	LastGCPause  time.Duration
+	Sessions     int
+	// sessions whose sendq is past sendQSaturationThreshold of max-sendq
+	SaturatedSessions int
+	// the fullest sendq, as a fraction of max-sendq
+	MaxSendQFraction float64
+}
+
+// LoadStatus measures the current load signals. It blocks for slightly
+// longer than schedulerProbeDuration.
+func (server *Server) LoadStatus() (result LoadStatus) {
+	start := time.Now()
+	time.Sleep(schedulerProbeDuration)
+	result.SchedulerLag = max(time.Since(start)-schedulerProbeDuration, 0)
+
+	result.Goroutines = runtime.NumGoroutine()
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	result.HeapBytes = memStats.HeapAlloc
+	result.LastGCPause = time.Duration(memStats.PauseNs[(memStats.NumGC+255)%256])
+
+	maxSendQ := server.Config().Server.MaxSendQBytes
+	for _, client := range server.clients.AllClients() {
+		for _, session := range client.Sessions() {
+			result.Sessions++
+			if maxSendQ <= 0 {
+				continue
+			}
+			fraction := float64(session.socket.Stats().SendQ) / float64(maxSendQ)
+			result.MaxSendQFraction = max(result.MaxSendQFraction, fraction)
+			if fraction >= sendQSaturationThreshold {
+				result.SaturatedSessions++
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,82 @@
+package irc
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/ergochat/irc-go/ircfmt"
+
+	"github.com/ergochat/ergo/irc/flatip"
+	"github.com/ergochat/ergo/irc/sno"
+)
+
+// login failures are tracked separately for the source IP (or rather, its
+// CIDR, at the granularity of the connection limits), and for the targeted
+// account or oper block. repeated failures lock the source out entirely, so
+// that attacks on many accounts from a single source are slowed. repeated
+// failures against an account, which may come from anywhere, only delay
+// further attempts on it, so that attacks spread across many IPs are slowed
+// too, without letting anyone lock a user out of their own account.
+
+// maxLoginThrottleDelay caps the delay applied to attempts on a throttled
+// account or oper block, so that the legitimate owner can still log in.
+const maxLoginThrottleDelay = 30 * time.Second
+
+func (server *Server) lockoutKeyIP(ip net.IP) string {
+	limits := &server.Config().Server.IPLimits
+	addr := flatip.FromNetIP(ip)
+	prefixLen := limits.CidrLenIPv6
+	if addr.IsIPv4() {
+		addr = addr.Mask(limits.CidrLenIPv4, 32)
+		prefixLen = limits.CidrLenIPv4
+	} else {
+		addr = addr.Mask(prefixLen, 128)
+	}
+	return fmt.Sprintf("ip %s/%d", addr.String(), prefixLen)
+}
+
+func lockoutKeyAccount(accountName string) string {
+	if cfname, err := CasefoldName(accountName); err == nil {
+		accountName = cfname
+	}
+	return "account " + accountName
+}
+
+func lockoutKeyOper(operName string) string {
+	return "oper " + operName
+}
+
+// checkLoginLockout returns how much longer the source IP key is locked out for,
+// or 0 if it isn't.
+func (server *Server) checkLoginLockout(ipKey string) (remaining time.Duration) {
+	return server.loginLockout.Check(ipKey)
+}
+
+// throttleLogin delays an attempt against an account or oper block that has
+// been failing repeatedly, until its lockout expires or for at most
+// maxLoginThrottleDelay, whichever is sooner.
+func (server *Server) throttleLogin(key string) {
+	if delay := server.loginLockout.Check(key); delay != 0 {
+		time.Sleep(min(delay, maxLoginThrottleDelay))
+	}
+}
+
+// loginFailed records a failed authentication attempt by `client` against each of
+// the keys, notifying opers of any resulting lockouts.
+func (server *Server) loginFailed(client *Client, mask sno.Mask, keys ...string) {
+	for _, key := range keys {
+		lockout, failures := server.loginLockout.Failure(key)
+		if lockout != 0 {
+			server.snomasks.Send(mask, fmt.Sprintf(ircfmt.Unescape("Locked out $c[grey][$r%s$c[grey]] for %v after %d failed login attempts (last attempt by $c[grey][$r%s$c[grey]])"), key, lockout, failures, client.NickMaskString()))
+			server.logger.Warning("accounts", "locked out", key, "for", lockout.String(), "after repeated login failures, last by", client.NickMaskString())
+		}
+	}
+}
+
+// loginSucceeded forgets past failures against the key; failures by IP are
+// deliberately left to expire, so that an attacker can't reset their count
+// by periodically logging into an account of their own.
+func (server *Server) loginSucceeded(key string) {
+	server.loginLockout.Success(key)
+}
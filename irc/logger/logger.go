@@ -6,8 +6,10 @@ package logger
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"sync"
@@ -78,7 +80,13 @@ type LoggingConfig struct {
 	MethodStdout  bool
 	MethodStderr  bool
 	MethodFile    bool
+	MethodSyslog  bool
 	Filename      string
+	MaxSizeString string   `yaml:"max-size"`
+	MaxSize       int64    `yaml:"max-size-real"`
+	SyslogTag     string   `yaml:"syslog-tag"`
+	Format        string   `yaml:"format"`
+	FormatJSON    bool     `yaml:"format-json"`
 	TypeString    string   `yaml:"type"`
 	Types         []string `yaml:"real-types"`
 	ExcludedTypes []string `yaml:"real-excluded-types"`
@@ -125,10 +133,12 @@ func (logger *Manager) ApplyConfig(config []LoggingConfig) error {
 		sLogger := singleLogger{
 			MethodSTDOUT: logConfig.MethodStdout,
 			MethodSTDERR: logConfig.MethodStderr,
-			MethodFile: fileMethod{
+			MethodFile: &fileMethod{
 				Enabled:  logConfig.MethodFile,
 				Filename: logConfig.Filename,
+				MaxSize:  logConfig.MaxSize,
 			},
+			FormatJSON:      logConfig.FormatJSON,
 			Level:           logConfig.Level,
 			Types:           typeMap,
 			ExcludedTypes:   excludedTypeMap,
@@ -141,13 +151,21 @@ func (logger *Manager) ApplyConfig(config []LoggingConfig) error {
 			logger.loggingRawIO.Store(1)
 		}
 		if sLogger.MethodFile.Enabled {
-			file, err := os.OpenFile(sLogger.MethodFile.Filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
-			if err != nil {
+			if err := sLogger.MethodFile.open(); err != nil {
 				lastErr = fmt.Errorf("Could not open log file %s [%s]", sLogger.MethodFile.Filename, err.Error())
 			}
-			writer := bufio.NewWriter(file)
-			sLogger.MethodFile.File = file
-			sLogger.MethodFile.Writer = writer
+		}
+		if logConfig.MethodSyslog {
+			tag := logConfig.SyslogTag
+			if tag == "" {
+				tag = "ergo"
+			}
+			writer, err := newSyslogWriter(tag)
+			if err != nil {
+				lastErr = fmt.Errorf("Could not connect to syslog [%s]", err.Error())
+			} else {
+				sLogger.MethodSyslog = writer
+			}
 		}
 		logger.loggers = append(logger.loggers, sLogger)
 	}
@@ -195,6 +213,59 @@ type fileMethod struct {
 	Filename string
 	File     *os.File
 	Writer   *bufio.Writer
+	// MaxSize is the size in bytes after which the file is rotated (0 to disable)
+	MaxSize int64
+	written int64
+}
+
+func (f *fileMethod) open() error {
+	file, err := os.OpenFile(f.Filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	f.written = 0
+	if fi, err := file.Stat(); err == nil {
+		f.written = fi.Size()
+	}
+	f.File = file
+	f.Writer = bufio.NewWriter(file)
+	return nil
+}
+
+// rotate moves the current log file to `filename.1` (replacing any previous
+// rotated file) and reopens the original filename. it must be called with
+// the file write lock held.
+func (f *fileMethod) rotate() error {
+	f.Writer.Flush()
+	f.File.Close()
+	if err := os.Rename(f.Filename, f.Filename+".1"); err != nil {
+		// try to keep logging to the original file regardless
+		f.open()
+		return err
+	}
+	return f.open()
+}
+
+func (f *fileMethod) write(line []byte) {
+	if f.File == nil {
+		return
+	}
+	if f.MaxSize > 0 && f.written > 0 && f.written+int64(len(line)) > f.MaxSize {
+		if f.rotate() != nil && f.File == nil {
+			return
+		}
+	}
+	f.Writer.Write(line)
+	f.Writer.Flush()
+	f.written += int64(len(line))
+}
+
+// jsonLogLine is a log line in the `json` format, for ingestion by log processors.
+type jsonLogLine struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Type    string `json:"type"`
+	Message string `json:"message"`
 }
 
 // singleLogger represents a single logger instance.
@@ -203,14 +274,19 @@ type singleLogger struct {
 	fileWriteLock   *sync.Mutex
 	MethodSTDOUT    bool
 	MethodSTDERR    bool
-	MethodFile      fileMethod
+	MethodFile      *fileMethod
+	MethodSyslog    syslogWriter
+	FormatJSON      bool
 	Level           Level
 	Types           map[string]bool
 	ExcludedTypes   map[string]bool
 }
 
 func (logger *singleLogger) Close() error {
-	if logger.MethodFile.Enabled {
+	if logger.MethodSyslog != nil {
+		logger.MethodSyslog.Close()
+	}
+	if logger.MethodFile.Enabled && logger.MethodFile.File != nil {
 		flushErr := logger.MethodFile.Writer.Flush()
 		closeErr := logger.MethodFile.File.Close()
 		if flushErr != nil {
@@ -224,7 +300,7 @@ func (logger *singleLogger) Close() error {
 // Log logs the given message with the given details.
 func (logger *singleLogger) Log(level Level, logType string, messageParts ...string) {
 	// no logging enabled
-	if !(logger.MethodSTDOUT || logger.MethodSTDERR || logger.MethodFile.Enabled) {
+	if !(logger.MethodSTDOUT || logger.MethodSTDERR || logger.MethodFile.Enabled || logger.MethodSyslog != nil) {
 		return
 	}
 
@@ -239,17 +315,46 @@ func (logger *singleLogger) Log(level Level, logType string, messageParts ...str
 		return
 	}
 
+	// syslog supplies its own timestamp and severity
+	if logger.MethodSyslog != nil {
+		var syslogBuf bytes.Buffer
+		fmt.Fprintf(&syslogBuf, "%s : ", logType)
+		for i, p := range messageParts {
+			syslogBuf.WriteString(p)
+
+			if i != len(messageParts)-1 {
+				syslogBuf.WriteString(" : ")
+			}
+		}
+		writeSyslog(logger.MethodSyslog, level, syslogBuf.String())
+	}
+
+	if !(logger.MethodSTDOUT || logger.MethodSTDERR || logger.MethodFile.Enabled) {
+		return
+	}
+
 	// assemble full line
 
 	var rawBuf bytes.Buffer
-	// XXX magic number here: 10 is len("connect-ip"), the longest log category name
-	// in current use. it's not a big deal if this number gets out of date.
-	fmt.Fprintf(&rawBuf, "%s : %-5s : %-10s : ", time.Now().UTC().Format("2006-01-02T15:04:05.000Z"), LogLevelDisplayNames[level], logType)
-	for i, p := range messageParts {
-		rawBuf.WriteString(p)
-
-		if i != len(messageParts)-1 {
-			rawBuf.WriteString(" : ")
+	now := time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+	if logger.FormatJSON {
+		line, _ := json.Marshal(jsonLogLine{
+			Time:    now,
+			Level:   LogLevelDisplayNames[level],
+			Type:    logType,
+			Message: strings.Join(messageParts, " : "),
+		})
+		rawBuf.Write(line)
+	} else {
+		// XXX magic number here: 10 is len("connect-ip"), the longest log category name
+		// in current use. it's not a big deal if this number gets out of date.
+		fmt.Fprintf(&rawBuf, "%s : %-5s : %-10s : ", now, LogLevelDisplayNames[level], logType)
+		for i, p := range messageParts {
+			rawBuf.WriteString(p)
+
+			if i != len(messageParts)-1 {
+				rawBuf.WriteString(" : ")
+			}
 		}
 	}
 	rawBuf.WriteRune('\n')
@@ -267,8 +372,7 @@ func (logger *singleLogger) Log(level Level, logType string, messageParts ...str
 	}
 	if logger.MethodFile.Enabled {
 		logger.fileWriteLock.Lock()
-		logger.MethodFile.Writer.Write(rawBuf.Bytes())
-		logger.MethodFile.Writer.Flush()
+		logger.MethodFile.write(rawBuf.Bytes())
 		logger.fileWriteLock.Unlock()
 	}
 }
@@ -0,0 +1,35 @@
+//go:build !windows && !plan9
+
+package logger
+
+import (
+	"log/syslog"
+)
+
+// syslogWriter is the subset of *syslog.Writer that we use.
+type syslogWriter interface {
+	Debug(string) error
+	Info(string) error
+	Warning(string) error
+	Err(string) error
+	Close() error
+}
+
+// newSyslogWriter connects to the local syslog daemon. on systemd hosts,
+// this is also how messages reach the journal.
+func newSyslogWriter(tag string) (syslogWriter, error) {
+	return syslog.New(syslog.LOG_DAEMON|syslog.LOG_INFO, tag)
+}
+
+func writeSyslog(writer syslogWriter, level Level, message string) {
+	switch level {
+	case LogDebug:
+		writer.Debug(message)
+	case LogInfo:
+		writer.Info(message)
+	case LogWarning:
+		writer.Warning(message)
+	default:
+		writer.Err(message)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build windows || plan9
+
+package logger
+
+import (
+	"errors"
+)
+
+type syslogWriter interface {
+	Close() error
+}
+
+func newSyslogWriter(tag string) (syslogWriter, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
+
+func writeSyslog(writer syslogWriter, level Level, message string) {
+}
@@ -43,6 +43,10 @@ func ApplyUserModeChanges(client *Client, changes modes.ModeChanges, force bool,
 				if (change.Mode == modes.Operator) && !(force && oper != nil) {
 					continue
 				}
+				// covert WHOIS is only available to operators
+				if change.Mode == modes.CovertWhois && !client.HasMode(modes.Operator) {
+					continue
+				}
 
 				if client.SetMode(change.Mode, true) {
 					if change.Mode == modes.Invisible && present {
@@ -64,6 +68,9 @@ func ApplyUserModeChanges(client *Client, changes modes.ModeChanges, force bool,
 							client.server.stats.ChangeOperators(-1)
 						}
 						applyOper(client, nil, nil)
+						if client.SetMode(modes.CovertWhois, false) {
+							applied = append(applied, modes.ModeChange{Mode: modes.CovertWhois, Op: modes.Remove})
+						}
 						if removedSnomasks != "" {
 							client.server.snomasks.RemoveClient(client)
 						}
@@ -112,7 +119,7 @@ func ApplyUserModeChanges(client *Client, changes modes.ModeChanges, force bool,
 	}
 
 	// return the changes we could actually apply
-	return applied
+	return applied.Canonicalize()
 }
 
 // parseDefaultModes uses the provided mode change parser to parse the rawModes.
@@ -322,6 +329,9 @@ func (channel *Channel) ApplyChannelModeChanges(client *Client, isSamode bool, c
 		}
 	}
 
+	anyApplied := len(applied) != 0
+	applied = applied.Canonicalize()
+
 	var includeFlags uint
 	for _, change := range applied {
 		switch change.Mode {
@@ -336,9 +346,10 @@ func (channel *Channel) ApplyChannelModeChanges(client *Client, isSamode bool, c
 	if includeFlags != 0 {
 		channel.MarkDirty(includeFlags)
 	}
+	channel.recordModeChanges(client, applied)
 
 	// #649: don't send 324 RPL_CHANNELMODEIS if we were only working with mask lists
-	if len(applied) == 0 && !alreadySentPrivError && (maskOpCount == 0 || maskOpCount < len(changes)) {
+	if !anyApplied && !alreadySentPrivError && (maskOpCount == 0 || maskOpCount < len(changes)) {
 		args := append([]string{details.nick, chname}, channel.modeStrings(client)...)
 		rb.Add(nil, client.server.name, RPL_CHANNELMODEIS, args...)
 		rb.Add(nil, client.server.name, RPL_CREATIONTIME, details.nick, chname, strconv.FormatInt(channel.createdTime.Unix(), 10))
@@ -17,7 +17,7 @@ var (
 	// SupportedUserModes are the user modes that we actually support (modifying).
 	SupportedUserModes = Modes{
 		Bot, Invisible, Operator, RegisteredOnly, ServerNotice, UserRoleplaying,
-		UserNoCTCP,
+		UserNoCTCP, CovertWhois, WallOps, SmartFilter,
 	}
 
 	// SupportedChannelModes are the channel modes that we support.
@@ -25,6 +25,7 @@ var (
 		BanMask, ChanRoleplaying, ExceptMask, InviteMask, InviteOnly, Key,
 		Moderated, NoOutside, OpOnlyTopic, RegisteredOnly, RegisteredOnlySpeak,
 		Secret, UserLimit, NoCTCP, Auditorium, OpModerated, Forward,
+		NoNotice, NoAction,
 	}
 )
 
@@ -86,6 +87,50 @@ func (changes ModeChanges) Strings() (result []string) {
 	return
 }
 
+// Canonicalize merges applied mode changes that affect the same mode (and,
+// for list and membership modes, the same argument), so that e.g. `+o-o nick nick`
+// collapses to nothing and `+k-k+k a a b` to `+k b`. Every change is assumed to
+// have actually taken effect, so successive changes to the same state alternate
+// between adding and removing; the position of the last change is retained.
+func (changes ModeChanges) Canonicalize() (result ModeChanges) {
+	type changeKey struct {
+		mode Mode
+		arg  string
+	}
+	keyOf := func(change ModeChange) changeKey {
+		switch change.Mode {
+		case Key, UserLimit, Forward:
+			// modes with a single setting: the last change supersedes the others
+			return changeKey{mode: change.Mode}
+		default:
+			return changeKey{mode: change.Mode, arg: change.Arg}
+		}
+	}
+
+	counts := make(map[changeKey]int, len(changes))
+	for _, change := range changes {
+		counts[keyOf(change)]++
+	}
+	seen := make(map[changeKey]int, len(changes))
+	for _, change := range changes {
+		key := keyOf(change)
+		seen[key]++
+		if seen[key] != counts[key] {
+			continue // superseded by a later change
+		}
+		switch key.mode {
+		case Key, UserLimit, Forward:
+			result = append(result, change)
+		default:
+			// an even number of alternating changes restores the original state
+			if counts[key]%2 == 1 {
+				result = append(result, change)
+			}
+		}
+	}
+	return
+}
+
 // Modes is just a raw list of modes
 type Modes []Mode
 
@@ -100,11 +145,13 @@ func (modes Modes) String() string {
 // User Modes
 const (
 	Bot             Mode = 'B'
+	CovertWhois     Mode = 'Y'
 	Invisible       Mode = 'i'
 	Operator        Mode = 'o'
 	Restricted      Mode = 'r'
 	RegisteredOnly  Mode = 'R'
 	ServerNotice    Mode = 's'
+	SmartFilter     Mode = 'J'
 	TLS             Mode = 'Z'
 	UserNoCTCP      Mode = 'T'
 	UserRoleplaying Mode = 'E'
@@ -130,6 +177,8 @@ const (
 	NoCTCP              Mode = 'C' // flag
 	OpModerated         Mode = 'U' // flag
 	Forward             Mode = 'f' // flag arg
+	NoNotice            Mode = 'T' // flag
+	NoAction            Mode = 'A' // flag
 )
 
 var (
@@ -159,19 +208,22 @@ var (
 //
 
 // SplitChannelMembershipPrefixes takes a target and returns the prefixes on it, then the name.
+// A trailing & is kept as part of the name unless what follows it is a # channel,
+// so that &channel is a local channel but &#channel is a STATUSMSG.
 func SplitChannelMembershipPrefixes(target string) (prefixes string, name string) {
-	name = target
-	for i := 0; i < len(name); i++ {
-		switch name[i] {
+	i := 0
+	for ; i < len(target); i++ {
+		switch target[i] {
 		case '~', '&', '@', '%', '+':
-			prefixes = target[:i+1]
-			name = target[i+1:]
-		default:
-			return
+			continue
 		}
+		break
+	}
+	if 0 < i && target[i-1] == '&' && !strings.HasPrefix(target[i:], "#") {
+		i--
 	}
 
-	return
+	return target[:i], target[i:]
 }
 
 // GetLowestChannelModePrefix returns the lowest channel prefix mode out of the given prefixes.
@@ -463,7 +515,7 @@ func ChanmodesToken() (result string) {
 	// type C: modes that take a parameter only when set, never when unset
 	C := Modes{UserLimit, Forward}
 	// type D: modes without parameters
-	D := Modes{InviteOnly, Moderated, NoOutside, OpOnlyTopic, ChanRoleplaying, Secret, NoCTCP, RegisteredOnly, RegisteredOnlySpeak, Auditorium, OpModerated}
+	D := Modes{InviteOnly, Moderated, NoOutside, OpOnlyTopic, ChanRoleplaying, Secret, NoCTCP, RegisteredOnly, RegisteredOnlySpeak, Auditorium, OpModerated, NoNotice, NoAction}
 
 	sort.Sort(ByCodepoint(A))
 	sort.Sort(ByCodepoint(B))
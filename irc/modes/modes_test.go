@@ -177,6 +177,35 @@ func TestParseChannelModeChanges(t *testing.T) {
 	}
 }
 
+func TestCanonicalizeModeChanges(t *testing.T) {
+	changes := ModeChanges{
+		{Op: Add, Mode: ChannelOperator, Arg: "shivaram"},
+		{Op: Add, Mode: Voice, Arg: "dan"},
+		{Op: Remove, Mode: ChannelOperator, Arg: "shivaram"},
+	}
+	assertEqual(changes.Canonicalize(), ModeChanges{{Op: Add, Mode: Voice, Arg: "dan"}}, t)
+	assertEqual(changes.Canonicalize().Strings(), []string{"+v", "dan"}, t)
+
+	changes = ModeChanges{
+		{Op: Add, Mode: InviteOnly},
+		{Op: Remove, Mode: InviteOnly},
+		{Op: Add, Mode: InviteOnly},
+		{Op: Add, Mode: Key, Arg: "a"},
+		{Op: Add, Mode: Key, Arg: "b"},
+		{Op: Add, Mode: BanMask, Arg: "x!*@*"},
+		{Op: Add, Mode: BanMask, Arg: "y!*@*"},
+		{Op: Remove, Mode: BanMask, Arg: "x!*@*"},
+	}
+	assertEqual(changes.Canonicalize(), ModeChanges{
+		{Op: Add, Mode: InviteOnly},
+		{Op: Add, Mode: Key, Arg: "b"},
+		{Op: Add, Mode: BanMask, Arg: "y!*@*"},
+	}, t)
+
+	changes = ModeChanges{{Op: Add, Mode: Invisible}, {Op: Remove, Mode: Invisible}}
+	assertEqual(len(changes.Canonicalize()), 0, t)
+}
+
 func TestSetMode(t *testing.T) {
 	set := NewModeSet()
 
@@ -289,3 +318,18 @@ func BenchmarkModeString(b *testing.B) {
 		_ = set.String()
 	}
 }
+
+func TestSplitChannelMembershipPrefixes(t *testing.T) {
+	check := func(target, expectedPrefixes, expectedName string) {
+		prefixes, name := SplitChannelMembershipPrefixes(target)
+		assertEqual(prefixes, expectedPrefixes, t)
+		assertEqual(name, expectedName, t)
+	}
+	check("#chan", "", "#chan")
+	check("@#chan", "@", "#chan")
+	check("~@#chan", "~@", "#chan")
+	check("&#chan", "&", "#chan")
+	check("&chan", "", "&chan")
+	check("@&chan", "@", "&chan")
+	check("nick", "", "nick")
+}
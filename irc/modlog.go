@@ -0,0 +1,73 @@
+package irc
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ergochat/ergo/irc/modes"
+)
+
+const (
+	// number of moderation events retained for each registered channel
+	channelModLogSize = 100
+)
+
+// ModLogEntry is a moderation event (kick, topic change, or mode change)
+// in a registered channel.
+type ModLogEntry struct {
+	Time    time.Time
+	Actor   string // nickmask of the client who performed the action
+	Account string
+	Action  string
+}
+
+// ModLog records recent moderation events in a registered channel, for the
+// channel's founder and operators to review with CS MODLOG. It is kept only
+// in memory and is independent of both channel history and the server logs.
+type ModLog struct {
+	sync.Mutex // tier 1
+	entries    []ModLogEntry
+}
+
+// Add records an event, discarding the oldest if the log is full.
+func (ml *ModLog) Add(entry ModLogEntry) {
+	ml.Lock()
+	defer ml.Unlock()
+
+	if len(ml.entries) >= channelModLogSize {
+		copy(ml.entries, ml.entries[1:])
+		ml.entries = ml.entries[:len(ml.entries)-1]
+	}
+	ml.entries = append(ml.entries, entry)
+}
+
+// Latest returns up to `limit` of the most recent events, oldest first.
+func (ml *ModLog) Latest(limit int) (result []ModLogEntry) {
+	ml.Lock()
+	defer ml.Unlock()
+
+	start := max(len(ml.entries)-limit, 0)
+	return append(result, ml.entries[start:]...)
+}
+
+// recordModeration adds an event to the channel's moderation log, if it is registered.
+func (channel *Channel) recordModeration(client *Client, action ...string) {
+	if !channel.IsRegistered() {
+		return
+	}
+	details := client.Details()
+	channel.modLog.Add(ModLogEntry{
+		Time:    time.Now().UTC(),
+		Actor:   details.nickMask,
+		Account: details.accountName,
+		Action:  strings.Join(action, " "),
+	})
+}
+
+// recordModeChanges adds applied mode changes to the channel's moderation log.
+func (channel *Channel) recordModeChanges(client *Client, applied modes.ModeChanges) {
+	if len(applied) != 0 {
+		channel.recordModeration(client, append([]string{"MODE"}, applied.Strings()...)...)
+	}
+}
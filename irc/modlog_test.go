@@ -0,0 +1,24 @@
+package irc
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestModLog(t *testing.T) {
+	var ml ModLog
+	assertEqual(len(ml.Latest(10)), 0)
+
+	for i := 0; i < channelModLogSize+5; i++ {
+		ml.Add(ModLogEntry{Action: fmt.Sprintf("KICK user%d", i)})
+	}
+
+	latest := ml.Latest(2)
+	assertEqual(len(latest), 2)
+	assertEqual(latest[0].Action, fmt.Sprintf("KICK user%d", channelModLogSize+3))
+	assertEqual(latest[1].Action, fmt.Sprintf("KICK user%d", channelModLogSize+4))
+
+	all := ml.Latest(1000)
+	assertEqual(len(all), channelModLogSize)
+	assertEqual(all[0].Action, "KICK user5")
+}
@@ -50,6 +50,12 @@ func performNickChange(server *Server, client *Client, target *Client, session *
 		} else {
 			rb.Add(nil, server.name, "FAIL", "SANICK", "NICKNAME_RESERVED", utils.SafeErrorParam(nickname), client.t("Nickname is reserved by a different account"))
 		}
+	} else if err == errNicknameDelayed {
+		if !isSanick {
+			rb.Add(nil, server.name, ERR_UNAVAILRESOURCE, details.nick, utils.SafeErrorParam(nickname), client.t("Nickname is temporarily unavailable"))
+		} else {
+			rb.Add(nil, server.name, "FAIL", "SANICK", "NICKNAME_UNAVAILABLE", utils.SafeErrorParam(nickname), client.t("Nickname is temporarily unavailable"))
+		}
 	} else if err == errNicknameInvalid {
 		if !isSanick {
 			rb.Add(nil, server.name, ERR_ERRONEUSNICKNAME, details.nick, utils.SafeErrorParam(nickname), client.t("Erroneous nickname"))
@@ -4,7 +4,10 @@
 package irc
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
+	"os"
 	"regexp"
 	"sort"
 	"strconv"
@@ -12,6 +15,7 @@ import (
 	"time"
 
 	"github.com/ergochat/irc-go/ircfmt"
+	"github.com/ergochat/irc-go/ircutils"
 
 	"github.com/ergochat/ergo/irc/caps"
 	"github.com/ergochat/ergo/irc/custime"
@@ -37,6 +41,10 @@ func servCmdRequiresBouncerEnabled(config *Config) bool {
 	return config.Accounts.Multiclient.Enabled
 }
 
+func servCmdRequiresTOTP(config *Config) bool {
+	return config.Accounts.AuthenticationEnabled && config.Accounts.TOTP.Enabled
+}
+
 func servCmdRequiresEmailReset(config *Config) bool {
 	return config.Accounts.Registration.EmailVerification.Enabled &&
 		config.Accounts.Registration.EmailVerification.PasswordReset.Enabled
@@ -105,10 +113,12 @@ will not be able to use it.`,
 		},
 		"identify": {
 			handler: nsIdentifyHandler,
-			help: `Syntax: $bIDENTIFY <username> [password]$b
+			help: `Syntax: $bIDENTIFY <username> [password] [code]$b
 
 IDENTIFY lets you login to the given username using either password auth, or
-certfp (your client certificate) if a password is not given.`,
+certfp (your client certificate) if a password is not given. If you have
+enabled two-factor authentication, the current code from your authenticator
+app must follow the password.`,
 			helpShort: `$bIDENTIFY$b lets you login to your account.`,
 			enabled:   servCmdRequiresAuthEnabled,
 			minParams: 1,
@@ -204,16 +214,34 @@ a code will display the necessary code.`,
 			handler: nsUnregisterHandler,
 			help: `Syntax: $bERASE <username> [code]$b
 
-ERASE deletes all records of an account, allowing it to be re-registered.
-This should be used with caution, because it violates an expectation that
-account names are permanent identifiers. Typically, UNREGISTER should be
-used instead. A confirmation code is required; invoking the command
-without a code will display the necessary code.`,
+ERASE deletes all records of an account, including the history messages
+it sent, allowing it to be re-registered. This should be used with caution,
+because it violates an expectation that account names are permanent
+identifiers. Typically, UNREGISTER should be used instead. A confirmation
+code is required; invoking the command without a code will display the
+necessary code. If you are not an IRC operator, ERASE on your own account
+sends an erasure request to the server operators, who must confirm it; this
+can be done at most once every 10 minutes.`,
 			helpShort: `$bERASE$b erases all records of an account, allowing reuse.`,
 			enabled:   servCmdRequiresAuthEnabled,
-			capabs:    []string{"accreg"},
 			minParams: 1,
 		},
+		"export": {
+			handler: nsExportHandler,
+			help: `Syntax: $bEXPORT [username]$b
+
+EXPORT asks the server operators for all the data the server holds about
+your account (registration details, grouped nicknames, vhost, certificate
+fingerprints, registered channels, and stored messages you sent); they will
+deliver it to you. IRC operators with the correct permissions can export
+the data of any account to a file on the server, which is overwritten by
+later exports of the same account. Each account can be exported at most
+once every 10 minutes.`,
+			helpShort:    `$bEXPORT$b exports the data held about your account.`,
+			enabled:      servCmdRequiresAuthEnabled,
+			authRequired: true,
+			maxParams:    1,
+		},
 		"verify": {
 			handler: nsVerifyHandler,
 			help: `Syntax: $bVERIFY <username> <code>$b
@@ -324,6 +352,9 @@ server operator allows it, this address can be used for password resets).
 As an additional security measure, if you have a password set, you must
 provide it as an additional argument to $bSET$b, for example,
 SET EMAIL test@example.com hunter2`,
+				`$bTIMEZONE$b
+'timezone' controls the timezone used to display times to you in service
+replies, e.g., 'America/New_York' or 'Europe/Berlin'. Use 'default' for UTC.`,
 			},
 			authRequired: true,
 			enabled:      servCmdRequiresAuthEnabled,
@@ -390,6 +421,18 @@ command lists all current suspensions.`,
 			minParams: 1,
 			capabs:    []string{"ban"},
 		},
+		"badge": {
+			handler: nsBadgeHandler,
+			help: `Syntax: $bBADGE <account> [role | CLEAR]$b
+
+BADGE assigns a display role to an account, such as "network helper" or
+"developer", which is shown in WHOIS for anyone logged into the account.
+With no role, it shows the current badge; CLEAR removes it.`,
+			helpShort: `$bBADGE$b assigns a display role to an account.`,
+			enabled:   servCmdRequiresAuthEnabled,
+			capabs:    []string{"accreg"},
+			minParams: 1,
+		},
 		"rename": {
 			handler: nsRenameHandler,
 			help: `Syntax: $bRENAME <account> <newname>$b
@@ -401,6 +444,28 @@ Currently, you can only change the canonical casefolding of an account
 			minParams: 2,
 			capabs:    []string{"accreg"},
 		},
+		"totp": {
+			handler: nsTOTPHandler,
+			help: `Syntax: $bTOTP <subcommand> [code]$b
+
+TOTP manages two-factor authentication for your account, using an
+authenticator app. Accepts the following subcommands:
+
+1. $bENABLE$b generates a secret to add to your authenticator app
+2. $bVERIFY <code>$b confirms the enrollment, displaying recovery codes
+3. $bDISABLE <code>$b disables two-factor authentication
+
+Once enabled, logging in with your password requires the current code
+(or one of your recovery codes), appended to the password after a colon,
+e.g., "hunter2:123456". IRC operators with the correct permissions can
+use $bTOTP RESET <account>$b to disable it for an account that has lost
+access to its codes.`,
+			helpShort:    `$bTOTP$b manages two-factor authentication.`,
+			enabled:      servCmdRequiresTOTP,
+			authRequired: true,
+			minParams:    1,
+			maxParams:    2,
+		},
 		"verifyemail": {
 			handler:      nsVerifyEmailHandler,
 			authRequired: true,
@@ -513,6 +578,12 @@ func displaySetting(service *ircService, settingName string, settings AccountSet
 		} else {
 			service.Notice(rb, client.t("You have no stored e-mail address"))
 		}
+	case "timezone":
+		if settings.Timezone != "" {
+			service.Notice(rb, fmt.Sprintf(client.t("Times will be displayed to you in the timezone: %s"), settings.Timezone))
+		} else {
+			service.Notice(rb, client.t("Times will be displayed to you in UTC"))
+		}
 	default:
 		service.Notice(rb, client.t("No such setting"))
 	}
@@ -672,6 +743,19 @@ func nsSetHandler(service *ircService, server *Server, client *Client, command s
 			out.Email = newValue
 			return
 		}
+	case "timezone":
+		newValue := params[1]
+		if strings.EqualFold(newValue, "default") || strings.EqualFold(newValue, "UTC") {
+			newValue = ""
+		} else if _, err = loadTimezone(newValue); err != nil {
+			err = errInvalidParams
+			break
+		}
+		munger = func(in AccountSettings) (out AccountSettings, err error) {
+			out = in
+			out.Timezone = newValue
+			return
+		}
 	default:
 		err = errInvalidParams
 	}
@@ -838,6 +922,10 @@ func nsIdentifyHandler(service *ircService, server *Server, client *Client, comm
 	} else {
 		username = params[0]
 		passphrase = params[1]
+		if len(params) > 2 {
+			// two-factor code, see splitTwoFactorCode
+			passphrase = passphrase + ":" + params[2]
+		}
 	}
 
 	// try passphrase
@@ -933,7 +1021,7 @@ func nsInfoHandler(service *ircService, server *Server, client *Client, command
 	}
 
 	service.Notice(rb, fmt.Sprintf(client.t("Account: %s"), account.Name))
-	registeredAt := account.RegisteredAt.Format(time.RFC1123)
+	registeredAt := client.formatTime(account.RegisteredAt)
 	service.Notice(rb, fmt.Sprintf(client.t("Registered at: %s"), registeredAt))
 
 	if account.Name == client.AccountName() || client.HasRoleCapabs("accreg") {
@@ -1132,18 +1220,127 @@ func nsUnregisterHandler(service *ircService, server *Server, client *Client, co
 		return
 	}
 
+	if erase && !client.HasRoleCapabs("accreg") {
+		// the account holder can only request erasure; an operator must confirm it
+		if !server.accounts.touchRequest(client.Account(), accountRequestErasure) {
+			service.Notice(rb, client.t("You requested erasure of this account recently; try again later"))
+			return
+		}
+		service.Notice(rb, client.t("Your erasure request has been sent to the server operators"))
+		server.logger.Info("accounts", "client", client.Nick(), "requested erasure of account", accountName)
+		server.snomasks.Send(sno.LocalAccounts, fmt.Sprintf(ircfmt.Unescape("Client $c[grey][$r%s$c[grey]] requested erasure of account $c[grey][$r%s$c[grey]]; to confirm, use /NS ERASE %s"), client.NickMaskString(), accountName, accountName))
+		return
+	}
+
 	err := server.accounts.Unregister(accountName, erase)
 	if err == errAccountDoesNotExist {
 		service.Notice(rb, client.t(err.Error()))
 	} else if err != nil {
 		service.Notice(rb, client.t("Error while unregistering account"))
 	} else {
+		if erase {
+			server.ForgetHistory(accountName)
+		}
 		service.Notice(rb, fmt.Sprintf(client.t("Successfully unregistered account %s"), accountName))
 		server.logger.Info("accounts", "client", client.Nick(), "unregistered account", accountName)
 		client.server.snomasks.Send(sno.LocalAccounts, fmt.Sprintf(ircfmt.Unescape("Client $c[grey][$r%s$c[grey]] unregistered account $c[grey][$r%s$c[grey]]"), client.NickMaskString(), accountName))
 	}
 }
 
+func nsTOTPHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
+	if strings.ToLower(params[0]) == "reset" {
+		if !client.HasRoleCapabs("accreg") || len(params) < 2 {
+			service.Notice(rb, client.t("Insufficient oper privs"))
+			return
+		}
+		cfAccount, err := CasefoldName(params[1])
+		if err == nil {
+			err = server.DisableTwoFactor(fmt.Sprintf(keyAccountTOTP, cfAccount), "", true)
+		}
+		if err != nil {
+			service.Notice(rb, client.t(errTwoFactorNotEnabled.Error()))
+			return
+		}
+		service.Notice(rb, fmt.Sprintf(client.t("Disabled two-factor authentication for account %s"), params[1]))
+		server.snomasks.Send(sno.LocalAccounts, fmt.Sprintf(ircfmt.Unescape("Operator $c[grey][$r%s$c[grey]] disabled two-factor authentication for account $c[grey][$r%s$c[grey]]"), client.Oper().Name, params[1]))
+		return
+	}
+
+	twoFactorCommand(client, fmt.Sprintf(keyAccountTOTP, client.Account()), client.AccountName(), params, func(message string) {
+		service.Notice(rb, message)
+	})
+}
+
+func nsExportHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
+	accountName := client.Account()
+	if len(params) > 0 {
+		accountName = params[0]
+	}
+	isOper := client.HasRoleCapabs("accreg")
+	if !(accountName == client.Account() || isOper) {
+		service.Notice(rb, client.t("Insufficient oper privs"))
+		return
+	}
+
+	data, err := server.accounts.ExportAccountData(accountName)
+	if err == errAccountDoesNotExist {
+		service.Notice(rb, client.t("Invalid account name"))
+		return
+	} else if err != nil {
+		service.Notice(rb, client.t("Internal error"))
+		return
+	}
+
+	requestType := accountRequestExport
+	if !isOper {
+		requestType = accountRequestExportRequest
+	}
+	if !server.accounts.touchRequest(data.NameCasefolded, requestType) {
+		service.Notice(rb, client.t("This account's data was exported recently; try again later"))
+		return
+	}
+
+	if !isOper {
+		// the export is written to a file on the server, so an operator must
+		// perform it and deliver the file to the account holder
+		service.Notice(rb, client.t("Your export request has been sent to the server operators"))
+		server.logger.Info("accounts", "client", client.Nick(), "requested export of account", data.Name)
+		server.snomasks.Send(sno.LocalAccounts, fmt.Sprintf(ircfmt.Unescape("Client $c[grey][$r%s$c[grey]] requested export of account $c[grey][$r%s$c[grey]]; to perform it, use /NS EXPORT %s"), client.NickMaskString(), data.Name, data.Name))
+		return
+	}
+
+	config := server.Config()
+	// one file per account, overwritten by later exports; as with HISTSERV EXPORT,
+	// don't include the account name itself in the filename because of escaping concerns
+	filename := fmt.Sprintf("account-%s.jsonl", utils.B32Encoder.EncodeToString([]byte(data.NameCasefolded)))
+	outfile, err := os.Create(config.getOutputPath(filename))
+	if err != nil {
+		server.logger.Error("accounts", "couldn't open export file", err.Error())
+		service.Notice(rb, client.t("Internal error"))
+		return
+	}
+	service.Notice(rb, fmt.Sprintf(client.t("Started exporting data for account %[1]s to file %[2]s"), data.Name, filename))
+	server.logger.Info("accounts", "client", client.Nick(), "exported data for account", data.Name, "to", filename)
+	server.snomasks.Send(sno.LocalAccounts, fmt.Sprintf(ircfmt.Unescape("Client $c[grey][$r%s$c[grey]] exported data for account $c[grey][$r%s$c[grey]] to file %s"), client.NickMaskString(), data.Name, filename))
+
+	go func() {
+		defer server.HandlePanic()
+
+		defer outfile.Close()
+		writer := bufio.NewWriter(outfile)
+		defer writer.Flush()
+
+		// the account record comes first, followed by one line per stored message
+		if err := json.NewEncoder(writer).Encode(data); err != nil {
+			server.logger.Error("accounts", "couldn't export account data", data.Name, err.Error())
+			return
+		}
+		if historyComplianceEnabled(config) {
+			server.historyDB.Export(data.NameCasefolded, writer)
+		}
+	}()
+}
+
 func nsVerifyHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
 	username, code := params[0], params[1]
 	err := server.accounts.Verify(client, username, code, false)
@@ -1317,8 +1514,8 @@ func nsClientsListHandler(service *ircService, server *Server, client *Client, p
 		if hasPrivs {
 			service.Notice(rb, fmt.Sprintf(client.t("Connection:  %s"), session.connInfo))
 		}
-		service.Notice(rb, fmt.Sprintf(client.t("Created at:  %s"), session.ctime.Format(time.RFC1123)))
-		service.Notice(rb, fmt.Sprintf(client.t("Last active: %s"), session.atime.Format(time.RFC1123)))
+		service.Notice(rb, fmt.Sprintf(client.t("Created at:  %s"), client.formatTime(session.ctime)))
+		service.Notice(rb, fmt.Sprintf(client.t("Last active: %s"), client.formatTime(session.atime)))
 		if session.certfp != "" {
 			service.Notice(rb, fmt.Sprintf(client.t("Certfp:      %s"), session.certfp))
 		}
@@ -1576,9 +1773,9 @@ func listAccountSuspensions(client *Client, rb *ResponseBuffer, source string) {
 func suspensionToString(client *Client, suspension AccountSuspension) (result string) {
 	duration := client.t("indefinite")
 	if suspension.Duration != time.Duration(0) {
-		duration = suspension.Duration.String()
+		duration = client.formatDuration(suspension.Duration)
 	}
-	ts := suspension.TimeCreated.Format(time.RFC1123)
+	ts := client.formatTime(suspension.TimeCreated)
 	reason := client.t("No reason given.")
 	if suspension.Reason != "" {
 		reason = fmt.Sprintf(client.t("Reason: %s"), suspension.Reason)
@@ -1651,3 +1848,40 @@ func nsRenameHandler(service *ircService, server *Server, client *Client, comman
 		}
 	}
 }
+
+const maxBadgeLen = 64
+
+func nsBadgeHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
+	account := params[0]
+	if len(params) == 1 {
+		accountData, err := server.accounts.LoadAccount(account)
+		if err != nil {
+			service.Notice(rb, client.t("No such account"))
+		} else if accountData.Settings.Badge == "" {
+			service.Notice(rb, fmt.Sprintf(client.t("Account %s has no badge"), accountData.Name))
+		} else {
+			service.Notice(rb, fmt.Sprintf(client.t("Account %[1]s has the badge: %[2]s"), accountData.Name, accountData.Settings.Badge))
+		}
+		return
+	}
+
+	badge := ircutils.SanitizeText(strings.Join(params[1:], " "), maxBadgeLen)
+	if strings.ToUpper(badge) == "CLEAR" {
+		badge = ""
+	}
+	_, err := server.accounts.ModifyAccountSettings(account, func(in AccountSettings) (out AccountSettings, err error) {
+		out = in
+		out.Badge = badge
+		return
+	})
+	if err != nil {
+		service.Notice(rb, fmt.Sprintf(client.t("Couldn't change badge: %s"), client.t(err.Error())))
+		return
+	}
+	if badge == "" {
+		service.Notice(rb, client.t("Successfully cleared the badge"))
+	} else {
+		service.Notice(rb, client.t("Successfully set the badge"))
+	}
+	server.logger.Info("accounts", client.Nick(), "set badge of account", account, "to", badge)
+}
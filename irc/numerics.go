@@ -32,12 +32,14 @@ const (
 	RPL_TRACERECONNECT            = "210"
 	RPL_STATSLINKINFO             = "211"
 	RPL_STATSCOMMANDS             = "212"
+	RPL_STATSCLINE                = "213"
 	RPL_ENDOFSTATS                = "219"
 	RPL_UMODEIS                   = "221"
 	RPL_SERVLIST                  = "234"
 	RPL_SERVLISTEND               = "235"
 	RPL_STATSUPTIME               = "242"
 	RPL_STATSOLINE                = "243"
+	RPL_STATSDEBUG                = "249"
 	RPL_LUSERCLIENT               = "251"
 	RPL_LUSEROP                   = "252"
 	RPL_LUSERUNKNOWN              = "253"
@@ -63,6 +65,7 @@ const (
 	RPL_WHOISOPERATOR             = "313"
 	RPL_WHOWASUSER                = "314"
 	RPL_ENDOFWHO                  = "315"
+	RPL_WHOISSPECIAL              = "320"
 	RPL_WHOISIDLE                 = "317"
 	RPL_ENDOFWHOIS                = "318"
 	RPL_WHOISCHANNELS             = "319"
@@ -76,6 +79,8 @@ const (
 	RPL_TOPIC                     = "332"
 	RPL_TOPICTIME                 = "333"
 	RPL_WHOISBOT                  = "335"
+	RPL_INVITEDLIST               = "336"
+	RPL_ENDOFINVITEDLIST          = "337"
 	RPL_WHOISACTUALLY             = "338"
 	RPL_INVITING                  = "341"
 	RPL_SUMMONING                 = "342"
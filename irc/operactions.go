@@ -0,0 +1,60 @@
+package irc
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ergochat/irc-go/ircfmt"
+
+	"github.com/ergochat/ergo/irc/connection_limits"
+	"github.com/ergochat/ergo/irc/sno"
+)
+
+// OperActionLimiter enforces the per-class action-limit on destructive oper
+// commands (KILL, KLINE, DLINE), so that a compromised or rogue oper account
+// can only do limited damage before other opers are alerted. Limits are
+// tracked by oper name, so re-opering doesn't reset them.
+type OperActionLimiter struct {
+	sync.Mutex // tier 1
+	throttles  map[string]*connection_limits.GenericThrottle
+}
+
+// Touch records an action by the named oper, returning whether it exceeds
+// the limit (in which case it is not recorded).
+func (ol *OperActionLimiter) Touch(operName string, limit ThrottleConfig) (throttled bool) {
+	if limit.MaxAttempts == 0 {
+		return false
+	}
+
+	ol.Lock()
+	defer ol.Unlock()
+
+	if ol.throttles == nil {
+		ol.throttles = make(map[string]*connection_limits.GenericThrottle)
+	}
+	throttle, ok := ol.throttles[operName]
+	if !ok {
+		throttle = new(connection_limits.GenericThrottle)
+		ol.throttles[operName] = throttle
+	}
+	// pick up any changes from a rehash
+	throttle.Duration = limit.Duration
+	throttle.Limit = limit.MaxAttempts
+	throttled, _ = throttle.Touch()
+	return
+}
+
+// checkOperActionLimit checks a destructive oper command against the oper's
+// action-limit, sending an error and alerting other opers if it's exceeded.
+func (server *Server) checkOperActionLimit(client *Client, command string, rb *ResponseBuffer) (allowed bool) {
+	oper := client.Oper()
+	if oper == nil || !server.operActions.Touch(oper.Name, oper.Class.ActionLimit) {
+		return true
+	}
+
+	rb.Add(nil, server.name, "FAIL", command, "RATE_LIMITED", client.t("You have used too many destructive oper commands recently; other operators have been notified"))
+	server.snomasks.SendAggregated(sno.LocalOpers, "action-limit "+oper.Name,
+		fmt.Sprintf(ircfmt.Unescape("Operator $c[grey][$r%s$c[grey]] (oper block $c[grey][$r%s$c[grey]]) exceeded the action limit with %s"), client.NickMaskString(), oper.Name, command))
+	server.logger.Warning("opers", "oper", oper.Name, "exceeded the action limit with", command, "as", client.NickMaskString())
+	return false
+}
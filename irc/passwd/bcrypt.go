@@ -3,8 +3,12 @@
 
 package passwd
 
-import "golang.org/x/crypto/bcrypt"
-import "golang.org/x/crypto/sha3"
+import (
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/sha3"
+)
 
 const (
 	MinCost     = bcrypt.MinCost
@@ -32,3 +36,48 @@ func CompareHashAndPassword(hashedPassword, password []byte) error {
 	sum := sha3.Sum512(password)
 	return bcrypt.CompareHashAndPassword(hashedPassword, sum[:])
 }
+
+// dummyHash is generated lazily, the first time it's needed
+type dummyHash struct {
+	once sync.Once
+	hash []byte
+}
+
+var (
+	dummyHashesMutex sync.Mutex
+	dummyHashes      = make(map[int]*dummyHash) // cost -> hash
+)
+
+// CheckConfigPassword verifies a password against a bcrypt hash from the config
+// file (as generated by `ergo genpasswd`, without the SHA-3 pre-hash). If there
+// is no hash, it still performs a comparison (see CheckMissingConfigPassword).
+func CheckConfigPassword(hashedPassword, password []byte) bool {
+	if len(hashedPassword) == 0 {
+		CheckMissingConfigPassword(bcrypt.DefaultCost, password)
+		return false
+	}
+	return bcrypt.CompareHashAndPassword(hashedPassword, password) == nil
+}
+
+// CheckMissingConfigPassword performs a comparison against a dummy hash with
+// the given cost, for when there is no hash to check the password against
+// (e.g., the named operator block doesn't exist). With the cost of the real
+// hashes, the time taken doesn't reveal that the hash is missing.
+func CheckMissingConfigPassword(cost int, password []byte) {
+	dummyHashesMutex.Lock()
+	dummy, ok := dummyHashes[cost]
+	if !ok {
+		dummy = new(dummyHash)
+		dummyHashes[cost] = dummy
+	}
+	dummyHashesMutex.Unlock()
+
+	dummy.once.Do(func() {
+		var err error
+		dummy.hash, err = bcrypt.GenerateFromPassword([]byte("dummy"), cost)
+		if err != nil {
+			dummy.hash, _ = bcrypt.GenerateFromPassword([]byte("dummy"), bcrypt.DefaultCost)
+		}
+	})
+	bcrypt.CompareHashAndPassword(dummy.hash, password)
+}
@@ -5,6 +5,8 @@ package passwd
 
 import (
 	"testing"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestBasic(t *testing.T) {
@@ -44,6 +46,23 @@ func TestLongPassphrases(t *testing.T) {
 	}
 }
 
+func TestCheckConfigPassword(t *testing.T) {
+	// the same way `ergo genpasswd` does it
+	hash, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !CheckConfigPassword(hash, []byte("hunter2")) {
+		t.Errorf("correct password was rejected")
+	}
+	if CheckConfigPassword(hash, []byte("hunter3")) {
+		t.Errorf("incorrect password was accepted")
+	}
+	if CheckConfigPassword(nil, []byte("")) || CheckConfigPassword(nil, []byte("dummy")) {
+		t.Errorf("a missing hash must not match anything")
+	}
+}
+
 // this could be useful for tuning the cost parameter on specific hardware
 func BenchmarkComparisons(b *testing.B) {
 	pass := []byte("passphrase for benchmarking")
@@ -0,0 +1,62 @@
+package irc
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// deploymentProfiles are named bundles of settings, selected with the top-level
+// `profile` config key. A profile is applied on top of the rest of the config
+// file, so its settings take precedence over the corresponding keys there.
+var deploymentProfiles = map[string]func(config *Config){
+	// a public network: open account and channel registration, nickname
+	// reservation, history, and flood protection for untrusted users
+	"public": func(config *Config) {
+		config.Accounts.AuthenticationEnabled = true
+		config.Accounts.Registration.Enabled = true
+		config.Accounts.NickReservation.Enabled = true
+		config.Channels.Registration.Enabled = true
+		config.History.Enabled = true
+		config.Fakelag.Enabled = true
+	},
+	// a private server for a team: everyone must log in to an account created
+	// by an operator (with NS SAREGISTER), and users are trusted not to flood
+	"private": func(config *Config) {
+		config.Accounts.AuthenticationEnabled = true
+		config.Accounts.Registration.Enabled = false
+		config.Accounts.RequireSasl.Enabled = true
+		config.Accounts.NickReservation.Enabled = true
+		config.Channels.Registration.Enabled = true
+		config.History.Enabled = true
+		config.Fakelag.Enabled = false
+	},
+	// a server that is only reachable as a Tor onion service: every listener
+	// is treated as a Tor listener, and flood protection is enabled
+	"tor-only": func(config *Config) {
+		for addr, listener := range config.Server.Listeners {
+			listener.Tor = true
+			config.Server.Listeners[addr] = listener
+		}
+		config.Fakelag.Enabled = true
+	},
+}
+
+// applyProfile applies the deployment profile selected in the config, if any.
+func (config *Config) applyProfile() error {
+	name := strings.ToLower(config.Profile)
+	if name == "" {
+		return nil
+	}
+	apply, ok := deploymentProfiles[name]
+	if !ok {
+		var profiles []string
+		for profile := range deploymentProfiles {
+			profiles = append(profiles, profile)
+		}
+		slices.Sort(profiles)
+		return fmt.Errorf("Unknown deployment profile %s (valid profiles: %s)", config.Profile, strings.Join(profiles, ", "))
+	}
+	apply(config)
+	return nil
+}
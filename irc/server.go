@@ -13,6 +13,7 @@ import (
 	"os"
 	"os/signal"
 	"runtime/pprof"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -21,6 +22,7 @@ import (
 	"time"
 
 	"github.com/ergochat/irc-go/ircfmt"
+	"github.com/ergochat/irc-go/ircutils"
 	"github.com/okzk/sdnotify"
 	"github.com/tidwall/buntdb"
 
@@ -31,6 +33,7 @@ import (
 	"github.com/ergochat/ergo/irc/flatip"
 	"github.com/ergochat/ergo/irc/flock"
 	"github.com/ergochat/ergo/irc/history"
+	"github.com/ergochat/ergo/irc/linkpreview"
 	"github.com/ergochat/ergo/irc/logger"
 	"github.com/ergochat/ergo/irc/modes"
 	"github.com/ergochat/ergo/irc/mysql"
@@ -40,6 +43,12 @@ import (
 
 const (
 	alwaysOnMaintenanceInterval = 30 * time.Minute
+	operExpirationInterval      = time.Minute
+	idleNotifyInterval          = 15 * time.Second
+	// how long to wait for clients' final messages to be written on shutdown
+	shutdownFlushTimeout = 5 * time.Second
+	// longest profile that can be requested with DEBUG CPUPROFILE
+	maxCPUProfileSeconds = 600
 )
 
 var (
@@ -56,9 +65,12 @@ var (
 	// never advertise SASL, to discourage people from sending their passwords:
 	stsOnlyCaps = caps.NewSet(caps.STS, caps.MessageTags, caps.ServerTime, caps.Batch, caps.LabeledResponse, caps.EchoMessage, caps.Nope)
 
-	// we only have standard channels for now. TODO: any updates to this
-	// will also need to be reflected in CasefoldChannel
-	chanTypes = "#"
+	// # is a standard channel, & a local one (never registered or persisted).
+	// & is also the channel admin prefix in PREFIX and STATUSMSG; to keep targets
+	// unambiguous, &#channel is always a STATUSMSG, and CasefoldChannel rejects
+	// local channel names beginning with &#. Any updates to this will also need
+	// to be reflected in CasefoldChannel and modes.SplitChannelMembershipPrefixes.
+	chanTypes = "#&"
 
 	throttleMessage = "You have attempted to connect too many times within a short duration. Wait a while, and you will be able to connect."
 )
@@ -76,6 +88,9 @@ type Server struct {
 	dlines            *DLineManager
 	helpIndexManager  HelpIndexManager
 	klines            *KLineManager
+	linkPreviews      linkpreview.Previewer
+	loginLockout      connection_limits.Lockout
+	operActions       OperActionLimiter
 	listeners         map[string]IRCListener
 	logger            *logger.Manager
 	monitorManager    MonitorManager
@@ -84,6 +99,12 @@ type Server struct {
 	rehashMutex       sync.Mutex // tier 4
 	rehashSignal      chan os.Signal
 	pprofServer       *http.Server
+	archiveInProgress atomic.Bool // whether a channel history archive is being written
+	cpuProfileMutex   sync.Mutex
+	cpuProfileFile    *os.File // profile being written by DEBUG STARTCPUPROFILE, if any
+	dnsblCache        DNSBLCache
+	apiServer         *http.Server
+	apiCache          apiCache
 	exitSignals       chan os.Signal
 	tracebackSignal   chan os.Signal
 	snomasks          SnoManager
@@ -95,7 +116,10 @@ type Server struct {
 	stats             Stats
 	semaphores        ServerSemaphores
 	flock             flock.Flocker
+	pidFile           string
 	defcon            atomic.Uint32
+	shutdownMessage   atomic.Pointer[string]
+	restart           atomic.Bool
 }
 
 // NewServer returns a new Oragono server.
@@ -134,6 +158,8 @@ func NewServer(config *Config, logger *logger.Manager) (*Server, error) {
 	}
 
 	time.AfterFunc(alwaysOnMaintenanceInterval, server.periodicAlwaysOnMaintenance)
+	time.AfterFunc(operExpirationInterval, server.periodicOperExpiration)
+	time.AfterFunc(idleNotifyInterval, server.periodicIdleNotify)
 
 	return server, nil
 }
@@ -143,9 +169,33 @@ func (server *Server) Shutdown() {
 	sdnotify.Stopping()
 	server.logger.Info("server", "Stopping server")
 
-	//TODO(dan): Make sure we disallow new nicks
+	// stop accepting new connections:
+	server.rehashMutex.Lock()
+	for addr, listener := range server.listeners {
+		listener.Stop()
+		delete(server.listeners, addr)
+	}
+	server.rehashMutex.Unlock()
+
+	// disconnect everyone with an explanation, then give the final messages
+	// (and anything else still in the sendqs) a chance to be written:
+	quitMessage := "Server is shutting down"
+	if message := server.shutdownMessage.Load(); message != nil {
+		quitMessage = *message
+	}
+	var sockets []*Socket
 	for _, client := range server.clients.AllClients() {
-		client.Notice("Server is shutting down")
+		client.Quit(quitMessage, nil)
+		for _, session := range client.Sessions() {
+			session.socket.Close()
+			sockets = append(sockets, session.socket)
+		}
+	}
+	deadline := time.Now().Add(shutdownFlushTimeout)
+	for _, socket := range sockets {
+		for !socket.IsFinalized() && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
 	}
 
 	// flush data associated with always-on clients:
@@ -156,6 +206,16 @@ func (server *Server) Shutdown() {
 	}
 
 	server.historyDB.Close()
+
+	if server.pidFile != "" {
+		if err := os.Remove(server.pidFile); err != nil {
+			server.logger.Error("shutdown", "Could not remove pid file", err.Error())
+		}
+	}
+	if server.flock != nil {
+		// release the lock explicitly, in case we're about to restart
+		server.flock.Unlock()
+	}
 	server.logger.Info("server", fmt.Sprintf("%s exiting", Ver))
 }
 
@@ -169,13 +229,37 @@ func (server *Server) Run() {
 			return
 		case <-server.rehashSignal:
 			server.logger.Info("server", "Rehashing due to SIGHUP")
-			go server.rehash()
+			go func() {
+				server.announceRehash("SIGHUP", server.rehash())
+			}()
 		case <-server.tracebackSignal:
 			go server.dumpStacks()
 		}
 	}
 }
 
+// Stop asks the server to shut down, as though it had received an exit
+// signal; Run will return once shutdown is complete.
+func (server *Server) Stop() {
+	select {
+	case server.exitSignals <- syscall.SIGTERM:
+	default:
+	}
+}
+
+// StopWithMessage is like Stop, but disconnects clients with `message`;
+// if `restart` is set, RestartRequested will return true once Run returns.
+func (server *Server) StopWithMessage(message string, restart bool) {
+	server.shutdownMessage.Store(&message)
+	server.restart.Store(restart)
+	server.Stop()
+}
+
+// RestartRequested returns whether the server was stopped with RESTART.
+func (server *Server) RestartRequested() bool {
+	return server.restart.Load()
+}
+
 func (server *Server) checkBans(config *Config, ipaddr net.IP, checkScripts bool) (banned bool, requireSASL bool, message string) {
 	// #671: do not enforce bans against loopback, as a failsafe
 	// note that this function is not used for Tor connections (checkTorLimits is used instead)
@@ -246,9 +330,60 @@ func (server *Server) checkBans(config *Config, ipaddr net.IP, checkScripts bool
 		}
 	}
 
+	if checkScripts && config.Server.DNSBL.Enabled {
+		list, cached := server.dnsblCache.Get(flat)
+		if !cached {
+			var complete bool
+			list, complete = CheckDNSBL(&config.Server.DNSBL, ipaddr)
+			if list != nil || complete {
+				server.dnsblCache.Add(flat, list, config.Server.DNSBL.CacheDuration)
+			}
+			if list != nil {
+				server.snomasks.Send(sno.LocalXline, fmt.Sprintf(ircfmt.Unescape("IP $c[grey][$r%s$c[grey]] is listed in $c[grey][$r%s$c[grey]]"), ipaddr.String(), list.Host))
+			}
+		}
+		if list != nil {
+			requireSASL := list.action == IPRequireSASL
+			if requireSASL {
+				server.logger.Info("connect-ip", "Requiring SASL from client due to dnsbl", ipaddr.String(), list.Host)
+				return false, true, list.Reason
+			} else {
+				// XXX roll back IP connection/throttling addition for the IP
+				server.connectionLimiter.RemoveClient(flat)
+				server.logger.Info("connect-ip", "Rejected client due to dnsbl", ipaddr.String(), list.Host)
+				return true, false, list.Reason
+			}
+		}
+	}
+
 	return false, false, ""
 }
 
+// checkClientLimit enforces server.client-limit against a newly registered
+// client (which has already been counted), and warns operators when the
+// limit is being approached.
+func (server *Server) checkClientLimit(config *Config, client *Client, session *Session) (rejected bool) {
+	limit := config.Server.ClientLimit
+	if limit.MaxClients <= 0 {
+		return false
+	}
+	total := server.stats.GetValues().Total
+	if total > limit.MaxClients {
+		// loopback is exempt as a failsafe, as with bans (#671)
+		exempt := (session.IP().IsLoopback() && !session.isTor) || (limit.ExemptSASL && client.Account() != "")
+		if !exempt {
+			client.Quit(fmt.Sprintf(client.t("This server is full (%d users); please try again later"), limit.MaxClients), nil)
+			server.logger.Info("connect", "Client rejected for client limit", client.NickMaskString())
+			return true
+		}
+	}
+	if limit.WarningPercent > 0 && total*100 >= limit.MaxClients*limit.WarningPercent {
+		server.snomasks.SendAggregated(sno.LocalConnects, "client-limit",
+			fmt.Sprintf(ircfmt.Unescape("Client count $c[grey][$r%d$c[grey]] is approaching the limit of $c[grey][$r%d$c[grey]]"), total, limit.MaxClients))
+	}
+	return false
+}
+
 func (server *Server) checkTorLimits() (banned bool, message string) {
 	switch server.torLimiter.AddClient() {
 	case connection_limits.ErrLimitExceeded:
@@ -272,6 +407,46 @@ func (server *Server) periodicAlwaysOnMaintenance() {
 	server.performAlwaysOnMaintenance(true, true)
 }
 
+// periodicOperExpiration removes operator status from operators who have been
+// idle for longer than oper-expiration.max-idle
+func (server *Server) periodicOperExpiration() {
+	defer func() {
+		time.AfterFunc(operExpirationInterval, server.periodicOperExpiration)
+	}()
+
+	defer server.HandlePanic()
+
+	maxIdle := server.Config().Server.OperExpiration.MaxIdle
+	if maxIdle == 0 {
+		return
+	}
+	for _, client := range server.clients.AllClients() {
+		if client.HasMode(modes.Operator) && maxIdle < client.IdleTime() {
+			client.expireOper("inactivity")
+		}
+	}
+}
+
+// periodicIdleNotify finds clients who have become idle, as configured by
+// server.idle-notify, and notifies interested clients (see dispatchIdleNotify).
+func (server *Server) periodicIdleNotify() {
+	defer func() {
+		time.AfterFunc(idleNotifyInterval, server.periodicIdleNotify)
+	}()
+
+	defer server.HandlePanic()
+
+	threshold := server.Config().Server.IdleNotify
+	if threshold <= 0 {
+		return
+	}
+	for _, client := range server.clients.AllClients() {
+		if idleTime, becameIdle := client.checkIdle(threshold); becameIdle {
+			dispatchIdleNotify(client, uint64(idleTime.Seconds()))
+		}
+	}
+}
+
 func (server *Server) performAlwaysOnMaintenance(checkExpiration, flushTimestamps bool) {
 	config := server.Config()
 	for _, client := range server.clients.AllClients() {
@@ -341,6 +516,9 @@ func (server *Server) tryRegister(c *Client, session *Session) (exiting bool) {
 	var quitMessage string
 	switch authOutcome {
 	case authFailPass:
+		if session.passStatus == serverPassFailed {
+			server.loginFailed(c, sno.LocalConnects, server.lockoutKeyIP(session.IP()))
+		}
 		quitMessage = c.t("Password incorrect")
 		c.Send(nil, server.name, ERR_PASSWDMISMATCH, "*", quitMessage)
 	case authFailSaslRequired, authFailTorSaslRequired:
@@ -349,6 +527,9 @@ func (server *Server) tryRegister(c *Client, session *Session) (exiting bool) {
 			quitMessage = c.t("You must log in with SASL to join this server")
 		}
 		c.Send(nil, c.server.name, "FAIL", "*", "ACCOUNT_REQUIRED", quitMessage)
+	case authFailTLSRequired:
+		quitMessage = c.t("Your account may only connect using TLS")
+		c.Send(nil, c.server.name, "FAIL", "*", "TLS_REQUIRED", quitMessage)
 	}
 	if authOutcome != authSuccess {
 		c.Quit(quitMessage, nil)
@@ -382,6 +563,10 @@ func (server *Server) tryRegister(c *Client, session *Session) (exiting bool) {
 	// count new user in statistics (before checking KLINEs, see #1303)
 	server.stats.Register(c.HasMode(modes.Invisible))
 
+	if server.checkClientLimit(config, c, session) {
+		return true
+	}
+
 	// check KLINEs (#671: ignore KLINEs for loopback connections)
 	if !session.IP().IsLoopback() || session.isTor {
 		isBanned, info := server.klines.CheckMasks(c.AllNickmasks()...)
@@ -421,7 +606,7 @@ func (server *Server) playRegistrationBurst(session *Session) {
 	// continue registration
 	d := c.Details()
 	server.logger.Info("connect", fmt.Sprintf("Client connected [%s] [u:%s] [r:%s]", d.nick, d.username, d.realname))
-	server.snomasks.Send(sno.LocalConnects, fmt.Sprintf("Client connected [%s] [u:%s] [h:%s] [ip:%s] [r:%s]", d.nick, d.username, session.rawHostname, session.IP().String(), d.realname))
+	server.snomasks.SendAggregated(sno.LocalConnects, session.IP().String(), fmt.Sprintf("Client connected [%s] [u:%s] [h:%s] [ip:%s] [r:%s]", d.nick, d.username, session.rawHostname, session.IP().String(), d.realname))
 	if d.account != "" {
 		server.sendLoginSnomask(d.nickMask, d.accountName)
 	}
@@ -440,8 +625,13 @@ func (server *Server) playRegistrationBurst(session *Session) {
 	if d.account != "" && session.capabilities.Has(caps.Persistence) {
 		reportPersistenceStatus(c, rb, false)
 	}
-	server.Lusers(c, rb)
-	server.MOTD(c, rb)
+	if !session.quietReg {
+		server.Lusers(c, rb)
+		server.MOTD(c, rb)
+	} else {
+		// clients may rely on 422 ERR_NOMOTD to detect the end of registration
+		rb.Add(nil, server.name, ERR_NOMOTD, d.nick, c.t("MOTD suppressed for this connection"))
+	}
 	rb.Send(true)
 
 	modestring := c.ModeString()
@@ -494,7 +684,14 @@ func (server *Server) Lusers(client *Client, rb *ResponseBuffer) {
 
 // MOTD serves the Message of the Day.
 func (server *Server) MOTD(client *Client, rb *ResponseBuffer) {
-	motdLines := server.Config().Server.motdLines
+	config := server.Config()
+	motdLines := config.Server.motdLines
+	// in order of precedence: SNI hostname, then listener, then the default
+	if sniLines, ok := config.Server.sniMOTDLines[rb.session.sniHostname]; ok && rb.session.sniHostname != "" {
+		motdLines = sniLines
+	} else if listenerLines, ok := config.Server.listenerMOTDLines[rb.session.motdFile]; ok && rb.session.motdFile != "" {
+		motdLines = listenerLines
+	}
 
 	if len(motdLines) < 1 {
 		rb.Add(nil, server.name, ERR_NOMOTD, client.nick, client.t("MOTD File is missing"))
@@ -529,6 +726,23 @@ func (client *Client) whoisChannelsNames(target *Client, multiPrefix bool, hasPr
 	return chstrs
 }
 
+// notifyWhois handles the side effects of an operator's WHOIS of another user:
+// the target is told about it if notify-oper-whois is enabled, unless the
+// operator has covert WHOIS (+Y) enabled, in which case the lookup is logged instead.
+func (client *Client) notifyWhois(target *Client) {
+	oper := client.Oper()
+	if oper == nil || client == target {
+		return
+	}
+	if client.HasMode(modes.CovertWhois) {
+		client.server.logger.Info("opers", "operator", oper.Name, "performed covert WHOIS of", target.NickMaskString())
+		return
+	}
+	if client.server.Config().Server.NotifyOperWhois {
+		target.Notice(fmt.Sprintf(target.t("*** Operator %s performed a WHOIS on you"), client.Nick()))
+	}
+}
+
 func (client *Client) getWhoisOf(target *Client, hasPrivs bool, rb *ResponseBuffer) {
 	oper := client.Oper()
 	cnick := client.Nick()
@@ -537,11 +751,25 @@ func (client *Client) getWhoisOf(target *Client, hasPrivs bool, rb *ResponseBuff
 	tnick := targetInfo.nick
 
 	whoischannels := client.whoisChannelsNames(target, rb.session.capabilities.Has(caps.MultiPrefix), oper.HasRoleCapab("sajoin"))
+	// sort by channel name, so that a truncated list is consistent between queries
+	slices.SortFunc(whoischannels, func(a, b string) int {
+		_, aName := modes.SplitChannelMembershipPrefixes(a)
+		_, bName := modes.SplitChannelMembershipPrefixes(b)
+		return strings.Compare(aName, bName)
+	})
+	var omittedChannels int
+	if limit := client.server.Config().Limits.WhoisChannels; 0 < limit && limit < len(whoischannels) && oper == nil && client != target {
+		omittedChannels = len(whoischannels) - limit
+		whoischannels = whoischannels[:limit]
+	}
 	if whoischannels != nil {
 		for _, line := range utils.BuildTokenLines(maxLastArgLength, whoischannels, " ") {
 			rb.Add(nil, client.server.name, RPL_WHOISCHANNELS, cnick, tnick, line)
 		}
 	}
+	if omittedChannels != 0 {
+		rb.Add(nil, client.server.name, RPL_WHOISSPECIAL, cnick, tnick, fmt.Sprintf(client.t("and %d more channel(s)"), omittedChannels))
+	}
 	if target.HasMode(modes.Operator) && operStatusVisible(client, target, oper != nil) {
 		tOper := target.Oper()
 		if tOper != nil {
@@ -560,6 +788,9 @@ func (client *Client) getWhoisOf(target *Client, hasPrivs bool, rb *ResponseBuff
 	}
 	if targetInfo.accountName != "*" {
 		rb.Add(nil, client.server.name, RPL_WHOISACCOUNT, cnick, tnick, targetInfo.accountName, client.t("is logged in as"))
+		if badge := target.AccountSettings().Badge; badge != "" {
+			rb.Add(nil, client.server.name, RPL_WHOISSPECIAL, cnick, tnick, fmt.Sprintf(client.t("is a %s"), badge))
+		}
 	}
 	if target.HasMode(modes.Bot) {
 		rb.Add(nil, client.server.name, RPL_WHOISBOT, cnick, tnick, fmt.Sprintf(ircfmt.Unescape(client.t("is a $bBot$b on %s")), client.server.Config().Network.Name))
@@ -608,6 +839,15 @@ func (server *Server) rehash() error {
 	return nil
 }
 
+// announceRehash informs operators of the outcome of a rehash.
+func (server *Server) announceRehash(source string, err error) {
+	if err == nil {
+		server.snomasks.Send(sno.LocalAnnouncements, fmt.Sprintf("Rehash (initiated by %s) completed successfully", source))
+	} else {
+		server.snomasks.Send(sno.LocalAnnouncements, fmt.Sprintf("Rehash (initiated by %s) failed: %s", source, ircutils.SanitizeText(err.Error(), 350)))
+	}
+}
+
 func (server *Server) applyConfig(config *Config) (err error) {
 	oldConfig := server.Config()
 	initial := oldConfig == nil
@@ -673,6 +913,10 @@ func (server *Server) applyConfig(config *Config) (err error) {
 	sendRawOutputNotice := !wasLoggingRawIO && nowLoggingRawIO
 
 	server.connectionLimiter.ApplyConfig(&config.Server.IPLimits)
+	server.loginLockout.ApplyConfig(config.Accounts.LoginLockout)
+	server.linkPreviews.ApplyConfig(config.Server.LinkPreviews)
+	server.dnsblCache.ApplyConfig()
+	server.whoWas.SetMaxAge(time.Duration(config.Limits.WhowasMaxAge))
 
 	tlConf := &config.Server.TorListeners
 	server.torLimiter.Configure(tlConf.MaxConnections, tlConf.ThrottleDuration, tlConf.MaxConnectionsPerDuration)
@@ -779,6 +1023,7 @@ func (server *Server) applyConfig(config *Config) (err error) {
 	}
 
 	server.setupPprofListener(config)
+	server.setupAPIListener(config)
 
 	// set RPL_ISUPPORT
 	var newISupportReplies [][]string
@@ -792,6 +1037,21 @@ func (server *Server) applyConfig(config *Config) (err error) {
 
 	// we are now ready to receive connections:
 	err = server.setupListeners(config)
+	if initial && err != nil && len(server.listeners) != 0 {
+		// a partial failure shouldn't prevent startup; setupListeners reported it
+		err = nil
+	}
+
+	if initial && err == nil && config.PidFile != "" {
+		// only write the pid file once startup has succeeded, so that it
+		// never names a process that failed to start
+		pid := []byte(strconv.Itoa(os.Getpid()) + "\n")
+		if err = os.WriteFile(config.PidFile, pid, 0644); err != nil {
+			err = fmt.Errorf("failed to write pid file %s: %w", config.PidFile, err)
+		} else {
+			server.pidFile = config.PidFile
+		}
+	}
 
 	if initial && err == nil {
 		server.logger.Info("server", "Server running")
@@ -819,6 +1079,50 @@ func (server *Server) applyConfig(config *Config) (err error) {
 	return err
 }
 
+// profileFilename returns a timestamped path under server.output-path
+// for a profile written with DEBUG, e.g., ergo-20240102-150405.123456789.prof;
+// the nanoseconds keep profiles written within the same second apart
+func (server *Server) profileFilename(extension string) string {
+	filename := fmt.Sprintf("ergo-%s.%s", time.Now().UTC().Format("20060102-150405.000000000"), extension)
+	return server.Config().getOutputPath(filename)
+}
+
+// startCPUProfile starts writing a CPU profile, returning the file it's written to.
+func (server *Server) startCPUProfile() (profile *os.File, err error) {
+	server.cpuProfileMutex.Lock()
+	defer server.cpuProfileMutex.Unlock()
+
+	if server.cpuProfileFile != nil {
+		return nil, errCPUProfileRunning
+	}
+	file, err := os.Create(server.profileFilename("prof"))
+	if err != nil {
+		return nil, err
+	}
+	if err := pprof.StartCPUProfile(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+	server.cpuProfileFile = file
+	return file, nil
+}
+
+// stopCPUProfile stops the CPU profile started by startCPUProfile, returning its path.
+// If `expected` is non-nil, the profile is only stopped if it is that one.
+func (server *Server) stopCPUProfile(expected *os.File) (profFile string, err error) {
+	server.cpuProfileMutex.Lock()
+	defer server.cpuProfileMutex.Unlock()
+
+	if server.cpuProfileFile == nil || (expected != nil && server.cpuProfileFile != expected) {
+		return "", errCPUProfileNotRunning
+	}
+	pprof.StopCPUProfile()
+	profFile = server.cpuProfileFile.Name()
+	err = server.cpuProfileFile.Close()
+	server.cpuProfileFile = nil
+	return
+}
+
 func (server *Server) setupPprofListener(config *Config) {
 	pprofListener := config.Debug.PprofListener
 	if server.pprofServer != nil {
@@ -914,6 +1218,7 @@ func (server *Server) setupListeners(config *Config) (err error) {
 	}
 
 	publicPlaintextListener := ""
+	var failures []string
 	// create new listeners that were not previously configured,
 	// or that couldn't be reloaded above:
 	for newAddr, newConfig := range config.Server.trueListeners {
@@ -929,11 +1234,17 @@ func (server *Server) setupListeners(config *Config) (err error) {
 				logListener(newAddr, newConfig)
 			} else {
 				server.logger.Error("server", "couldn't listen on", newAddr, newErr.Error())
-				err = newErr
+				failures = append(failures, fmt.Sprintf("%s (%s)", newAddr, newErr.Error()))
 			}
 		}
 	}
 
+	if len(failures) != 0 {
+		slices.Sort(failures)
+		err = fmt.Errorf("couldn't listen on %s", strings.Join(failures, ", "))
+		server.logger.Warning("listeners", fmt.Sprintf("listening on %d of %d configured listeners; failed: %s", len(server.listeners), len(config.Server.trueListeners), strings.Join(failures, ", ")))
+	}
+
 	if publicPlaintextListener != "" {
 		server.logger.Warning("listeners", fmt.Sprintf("Warning: your server is configured with public plaintext listener %s. Consider disabling it for improved security and privacy.", publicPlaintextListener))
 	}
@@ -941,6 +1252,71 @@ func (server *Server) setupListeners(config *Config) (err error) {
 	return
 }
 
+// ListenerStatus describes a configured listener for STATS p.
+type ListenerStatus struct {
+	Addr   string
+	Open   bool
+	Config utils.ListenerConfig
+	Stats  utils.ListenerStats
+}
+
+// ListenerStatuses returns the status of every configured listener.
+func (server *Server) ListenerStatuses() (result []ListenerStatus) {
+	server.rehashMutex.Lock()
+	defer server.rehashMutex.Unlock()
+
+	config := server.Config()
+	for addr, lconf := range config.Server.trueListeners {
+		status := ListenerStatus{Addr: addr, Config: lconf}
+		if listener, ok := server.listeners[addr]; ok {
+			status.Open = true
+			status.Stats = listener.Stats()
+		}
+		result = append(result, status)
+	}
+	slices.SortFunc(result, func(a, b ListenerStatus) int {
+		return strings.Compare(a.Addr, b.Addr)
+	})
+	return
+}
+
+// CloseListener stops accepting connections on a configured listener, without
+// disconnecting existing clients. The listener will be reopened on rehash.
+func (server *Server) CloseListener(addr string) error {
+	server.rehashMutex.Lock()
+	defer server.rehashMutex.Unlock()
+
+	listener, ok := server.listeners[addr]
+	if !ok {
+		return errNoSuchListener
+	}
+	delete(server.listeners, addr)
+	server.logger.Info("listeners", fmt.Sprintf("stopped listening on %s.", addr))
+	return listener.Stop()
+}
+
+// OpenListener starts a configured listener that was previously closed.
+func (server *Server) OpenListener(addr string) error {
+	server.rehashMutex.Lock()
+	defer server.rehashMutex.Unlock()
+
+	config := server.Config()
+	lconf, ok := config.Server.trueListeners[addr]
+	if !ok {
+		return errNoSuchListener
+	}
+	if _, ok := server.listeners[addr]; ok {
+		return errListenerAlreadyOpen
+	}
+	listener, err := NewListener(server, addr, lconf, config.Server.UnixBindMode)
+	if err != nil {
+		return err
+	}
+	server.listeners[addr] = listener
+	server.logger.Info("listeners", fmt.Sprintf("now listening on %s.", addr))
+	return nil
+}
+
 // Gets the abstract sequence from which we're going to query history;
 // we may already know the channel we're querying, or we may have
 // to look it up via a string query. This function is responsible for
@@ -962,7 +1338,7 @@ func (server *Server) GetHistorySequence(providedChannel *Channel, client *Clien
 	restriction := HistoryCutoffNone
 	channel = providedChannel
 	if channel == nil {
-		if strings.HasPrefix(query, "#") {
+		if isChannelName(query) {
 			channel = server.channels.Get(query)
 			if channel == nil {
 				return
@@ -1076,7 +1452,7 @@ func (server *Server) DeleteMessage(target, msgid, accountName string) (err erro
 	var hist *history.Buffer
 
 	if target != "" {
-		if target[0] == '#' {
+		if isChannelName(target) {
 			channel := server.channels.Get(target)
 			if channel != nil {
 				if status, _, _ := channel.historyStatus(config); status == HistoryEphemeral {
@@ -1108,7 +1484,7 @@ func (server *Server) DeleteMessage(target, msgid, accountName string) (err erro
 }
 
 func (server *Server) UnfoldName(cfname string) (name string) {
-	if strings.HasPrefix(cfname, "#") {
+	if isChannelName(cfname) {
 		return server.channels.UnfoldName(cfname)
 	}
 	return server.clients.UnfoldNick(cfname)
@@ -1120,6 +1496,9 @@ type elistMatcher struct {
 	MinClients       int
 	MaxClientsActive bool
 	MaxClients       int
+	// these match the ChanServ-configurable channel metadata
+	Language string
+	Category string
 }
 
 // Matches checks whether the given channel matches our matches.
@@ -1136,9 +1515,25 @@ func (matcher *elistMatcher) Matches(channel *Channel) bool {
 		}
 	}
 
+	if matcher.Language != "" || matcher.Category != "" {
+		settings := channel.Settings()
+		if matcher.Language != "" && !languageTagMatches(settings.Language, matcher.Language) {
+			return false
+		}
+		if matcher.Category != "" && settings.Category != matcher.Category {
+			return false
+		}
+	}
+
 	return true
 }
 
+// languageTagMatches checks a channel's language against a LIST filter;
+// a filter of "pt" matches a channel language of "pt-br"
+func languageTagMatches(language, filter string) bool {
+	return language == filter || strings.HasPrefix(language, filter+"-")
+}
+
 var (
 	infoString1 = strings.Split(`
       __ __  ______ ___  ______ ___ 
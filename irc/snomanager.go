@@ -3,19 +3,46 @@ package irc
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/ergochat/ergo/irc/sno"
 	"github.com/ergochat/irc-go/ircfmt"
 )
 
+const (
+	// after this many notices with the same aggregation key within
+	// snoAggregateWindow, further notices are suppressed and summarized
+	snoAggregateBurst  = 5
+	snoAggregateWindow = 10 * time.Second
+)
+
+type snoAggregateKey struct {
+	mask sno.Mask
+	key  string
+}
+
+type snoAggregate struct {
+	count      int
+	suppressed int
+	last       string
+}
+
 // SnoManager keeps track of which clients to send snomasks to.
 type SnoManager struct {
 	sendListMutex sync.RWMutex // tier 2
 	sendLists     map[sno.Mask]map[*Client]bool
+
+	aggregateMutex sync.Mutex // tier 1
+	aggregates     map[snoAggregateKey]*snoAggregate
+	burst          int
+	window         time.Duration
 }
 
 func (m *SnoManager) Initialize() {
 	m.sendLists = make(map[sno.Mask]map[*Client]bool)
+	m.aggregates = make(map[snoAggregateKey]*snoAggregate)
+	m.burst = snoAggregateBurst
+	m.window = snoAggregateWindow
 }
 
 // AddMasks adds the given snomasks to the client.
@@ -72,8 +99,67 @@ func (m *SnoManager) RemoveClient(client *Client) {
 	}
 }
 
-// Send sends the given snomask to all users signed up for it.
+// Send sends the given snomask to all users signed up for it. Bursts of
+// identical notices are summarized instead of being sent individually.
 func (m *SnoManager) Send(mask sno.Mask, content string) {
+	m.SendAggregated(mask, content, content)
+}
+
+// SendAggregated sends the given snomask to all users signed up for it,
+// unless too many notices with the same key (e.g., the IP of a connecting
+// client) were sent recently; those are counted and summarized later.
+func (m *SnoManager) SendAggregated(mask sno.Mask, key, content string) {
+	if !m.hasListeners(mask) || !m.admit(mask, key, content) {
+		return
+	}
+	m.send(mask, content)
+}
+
+func (m *SnoManager) hasListeners(mask sno.Mask) bool {
+	m.sendListMutex.RLock()
+	defer m.sendListMutex.RUnlock()
+
+	return len(m.sendLists[mask]) != 0
+}
+
+// admit records a notice for aggregation and returns whether it should be sent.
+func (m *SnoManager) admit(mask sno.Mask, key, content string) bool {
+	aKey := snoAggregateKey{mask: mask, key: key}
+
+	m.aggregateMutex.Lock()
+	defer m.aggregateMutex.Unlock()
+
+	aggregate := m.aggregates[aKey]
+	if aggregate == nil {
+		aggregate = new(snoAggregate)
+		m.aggregates[aKey] = aggregate
+		time.AfterFunc(m.window, func() {
+			m.flush(aKey)
+		})
+	}
+	aggregate.count++
+	if aggregate.count <= m.burst {
+		return true
+	}
+	aggregate.suppressed++
+	aggregate.last = content
+	return false
+}
+
+// flush ends the aggregation window for a key, summarizing anything suppressed.
+func (m *SnoManager) flush(aKey snoAggregateKey) {
+	m.aggregateMutex.Lock()
+	aggregate := m.aggregates[aKey]
+	delete(m.aggregates, aKey)
+	m.aggregateMutex.Unlock()
+
+	if aggregate == nil || aggregate.suppressed == 0 {
+		return
+	}
+	m.send(aKey.mask, fmt.Sprintf("%d similar notices suppressed in the last %v; the most recent was: %s", aggregate.suppressed, m.window, aggregate.last))
+}
+
+func (m *SnoManager) send(mask sno.Mask, content string) {
 	m.sendListMutex.RLock()
 	defer m.sendListMutex.RUnlock()
 
@@ -0,0 +1,38 @@
+package irc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ergochat/ergo/irc/sno"
+)
+
+func TestSnoAggregation(t *testing.T) {
+	var m SnoManager
+	m.Initialize()
+	m.window = time.Hour
+
+	for i := 0; i < m.burst; i++ {
+		if !m.admit(sno.LocalConnects, "10.0.0.1", "connect") {
+			t.Fatalf("notice %d should have been sent", i)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if m.admit(sno.LocalConnects, "10.0.0.1", "connect") {
+			t.Errorf("notice past the burst should have been suppressed")
+		}
+	}
+	if !m.admit(sno.LocalConnects, "10.0.0.2", "connect") {
+		t.Errorf("notices with a different key should be sent")
+	}
+	if !m.admit(sno.LocalQuits, "10.0.0.1", "quit") {
+		t.Errorf("notices for a different mask should be sent")
+	}
+
+	aKey := snoAggregateKey{mask: sno.LocalConnects, key: "10.0.0.1"}
+	assertEqual(m.aggregates[aKey].suppressed, 3)
+	m.flush(aKey)
+	if !m.admit(sno.LocalConnects, "10.0.0.1", "connect") {
+		t.Errorf("notices should be sent again after the window ends")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"io"
 	"sync"
+	"sync/atomic"
 )
 
 var (
@@ -33,6 +34,12 @@ type Socket struct {
 	sendQExceeded bool
 	finalData     []byte // what to send when we die
 	finalized     bool
+
+	// traffic counters, for STATS l
+	linesRead    atomic.Uint64
+	bytesRead    atomic.Uint64
+	linesWritten atomic.Uint64
+	bytesWritten atomic.Uint64
 }
 
 // NewSocket returns a new Socket.
@@ -63,6 +70,10 @@ func (socket *Socket) Read() (string, error) {
 
 	lineBytes, err := socket.conn.ReadLine()
 	line := string(lineBytes)
+	if err == nil {
+		socket.linesRead.Add(1)
+		socket.bytesRead.Add(uint64(len(lineBytes)))
+	}
 
 	if err == io.EOF {
 		socket.Close()
@@ -93,6 +104,8 @@ func (socket *Socket) Write(data []byte) (err error) {
 		} else {
 			socket.buffers = append(socket.buffers, data)
 			socket.totalLength = prospectiveLen
+			socket.linesWritten.Add(1)
+			socket.bytesWritten.Add(uint64(len(data)))
 		}
 	}
 	socket.Unlock()
@@ -137,10 +150,34 @@ func (socket *Socket) BlockingWrite(data []byte) (err error) {
 	err = socket.conn.WriteLine(data)
 	if err != nil {
 		socket.finalize()
+	} else {
+		socket.linesWritten.Add(1)
+		socket.bytesWritten.Add(uint64(len(data)))
 	}
 	return
 }
 
+// SocketStats is a snapshot of a socket's traffic counters.
+type SocketStats struct {
+	SendQ        int
+	LinesRead    uint64
+	BytesRead    uint64
+	LinesWritten uint64
+	BytesWritten uint64
+}
+
+// Stats returns the socket's traffic counters and the current length of its sendq.
+func (socket *Socket) Stats() (result SocketStats) {
+	socket.Lock()
+	result.SendQ = socket.totalLength
+	socket.Unlock()
+	result.LinesRead = socket.linesRead.Load()
+	result.BytesRead = socket.bytesRead.Load()
+	result.LinesWritten = socket.linesWritten.Load()
+	result.BytesWritten = socket.bytesWritten.Load()
+	return
+}
+
 // wakeWriter starts the goroutine that actually performs the write, without blocking
 func (socket *Socket) wakeWriter() {
 	if socket.writeLock.TryLock() {
@@ -164,6 +201,14 @@ func (socket *Socket) IsClosed() bool {
 	return socket.closed
 }
 
+// IsFinalized returns whether the socket has been closed and its final
+// data (if any) written.
+func (socket *Socket) IsFinalized() bool {
+	socket.Lock()
+	defer socket.Unlock()
+	return socket.finalized
+}
+
 // is there data to write?
 func (socket *Socket) readyToWrite() bool {
 	socket.Lock()
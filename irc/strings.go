@@ -60,6 +60,11 @@ const (
 	// confusables detection: standard skeleton algorithm (which may be ineffective
 	// over the larger set of permitted identifiers)
 	CasemappingPermissive
+	// "rfc1459" is the traditional ircd behavior for compatibility with older networks:
+	// casefolding/validation: as for "ascii", but []\~ are treated as the uppercase
+	// versions of {}|^
+	// confusables detection: none
+	CasemappingRFC1459
 )
 
 // XXX this is a global variable without explicit synchronization.
@@ -110,6 +115,8 @@ func casefoldWithSetting(str string, setting Casemapping) (string, error) {
 		return foldASCII(str)
 	case CasemappingPermissive:
 		return foldPermissive(str)
+	case CasemappingRFC1459:
+		return foldRFC1459(str)
 	}
 }
 
@@ -119,9 +126,17 @@ func CasefoldChannel(name string) (string, error) {
 		return "", errStringIsEmpty
 	}
 
-	// don't casefold the preceding #'s
+	// don't casefold the preceding #'s, or the & of a local channel
 	var start int
-	for start = 0; start < len(name) && name[start] == '#'; start += 1 {
+	if name[0] == '&' {
+		// &#channel would be indistinguishable from a STATUSMSG to the admins of #channel
+		if len(name) > 1 && name[1] == '#' {
+			return "", errInvalidCharacter
+		}
+		start = 1
+	} else {
+		for start = 0; start < len(name) && name[start] == '#'; start += 1 {
+		}
 	}
 
 	if start == 0 {
@@ -145,6 +160,18 @@ func CasefoldChannel(name string) (string, error) {
 	return name[:start] + lowered, err
 }
 
+// isChannelName returns whether a target is a channel (as opposed to a nickname),
+// judging by its first character.
+func isChannelName(name string) bool {
+	return len(name) != 0 && strings.IndexByte(chanTypes, name[0]) != -1
+}
+
+// isLocalChannelName returns whether a channel name denotes a local (&) channel,
+// which cannot be registered and whose state is never persisted.
+func isLocalChannelName(name string) bool {
+	return len(name) != 0 && name[0] == '&'
+}
+
 // CasefoldName returns a casefolded version of a nick/user name.
 func CasefoldName(name string) (string, error) {
 	lowered, err := Casefold(name)
@@ -169,7 +196,7 @@ func CasefoldName(name string) (string, error) {
 // it determines whether the target is a channel name or nickname and
 // applies the appropriate casefolding rules.
 func CasefoldTarget(name string) (string, error) {
-	if strings.HasPrefix(name, "#") {
+	if isChannelName(name) {
 		return CasefoldChannel(name)
 	} else {
 		return CasefoldName(name)
@@ -214,7 +241,7 @@ func Skeleton(name string) (string, error) {
 	switch globalCasemappingSetting {
 	default:
 		return realSkeleton(name)
-	case CasemappingASCII:
+	case CasemappingASCII, CasemappingRFC1459:
 		// identity function is fine because we independently case-normalize in Casefold
 		return name, nil
 	}
@@ -302,6 +329,16 @@ func foldASCII(str string) (result string, err error) {
 	return strings.ToLower(str), nil
 }
 
+var rfc1459Replacer = strings.NewReplacer("[", "{", "]", "}", "\\", "|", "~", "^")
+
+func foldRFC1459(str string) (result string, err error) {
+	result, err = foldASCII(str)
+	if err != nil {
+		return
+	}
+	return rfc1459Replacer.Replace(result), nil
+}
+
 func IsPrintableASCII(str string) bool {
 	for i := 0; i < len(str); i++ {
 		// allow space here because it's technically printable;
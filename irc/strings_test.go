@@ -48,6 +48,10 @@ func TestCasefoldChannel(t *testing.T) {
 			channel: "##Ubuntu",
 			folded:  "##ubuntu",
 		},
+		{
+			channel: "&Local",
+			folded:  "&local",
+		},
 		{
 			channel: "#中文频道",
 			folded:  "#中文频道",
@@ -63,6 +67,8 @@ func TestCasefoldChannel(t *testing.T) {
 		"", "#*starpower", "# NASA", "#interro?", "OOF#", "foo",
 		// bidi violation mixing latin and hebrew characters:
 		"#shalomעליכם",
+		// looks like a STATUSMSG to the admins of #local:
+		"&#local",
 		"#tab\tcharacter", "#\t", "#carriage\rreturn",
 	} {
 		testCases = append(testCases, channelTest{channel: errCase, err: true})
@@ -269,6 +275,17 @@ func TestFoldASCII(t *testing.T) {
 	tester("a != b", "A != B", true)
 }
 
+func TestFoldRFC1459(t *testing.T) {
+	tester := func(first, second string, equal bool) {
+		validFoldTester(first, second, equal, foldRFC1459, t)
+	}
+	tester("shivaram", "SHIVARAM", true)
+	tester("X|Y", "x\\y", true)
+	tester("[away]", "{AWAY}", true)
+	tester("a~", "A^", true)
+	tester("a-b", "a_b", false)
+}
+
 func TestFoldASCIIInvalid(t *testing.T) {
 	_, err := foldASCII("\x01")
 	if err == nil {
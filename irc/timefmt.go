@@ -0,0 +1,77 @@
+package irc
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// cache of timezones chosen with NS SET TIMEZONE, since time.LoadLocation
+// reads the zoneinfo database from disk every time
+var timezoneCache sync.Map // string -> *time.Location
+
+func loadTimezone(name string) (*time.Location, error) {
+	if location, ok := timezoneCache.Load(name); ok {
+		return location.(*time.Location), nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	timezoneCache.Store(name, location)
+	return location, nil
+}
+
+// formatTime renders a timestamp for display to the client, in the timezone
+// they chose with NS SET TIMEZONE (UTC by default).
+func (client *Client) formatTime(t time.Time) string {
+	location := time.UTC
+	if name := client.AccountSettings().Timezone; name != "" {
+		if loaded, err := loadTimezone(name); err == nil {
+			location = loaded
+		}
+	}
+	return t.In(location).Format(time.RFC1123)
+}
+
+// formatDuration renders a duration for display to the client in words,
+// e.g., "2 hours, 5 minutes", in the client's language. Only the most
+// significant unit and the one after it are shown.
+func (client *Client) formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	if d < time.Second {
+		return client.t("less than a second")
+	}
+
+	days := int(d / (24 * time.Hour))
+	hours := int(d/time.Hour) % 24
+	minutes := int(d/time.Minute) % 60
+	seconds := int(d/time.Second) % 60
+	units := []string{
+		durationUnit(days, client.t("1 day"), client.t("%d days")),
+		durationUnit(hours, client.t("1 hour"), client.t("%d hours")),
+		durationUnit(minutes, client.t("1 minute"), client.t("%d minutes")),
+		durationUnit(seconds, client.t("1 second"), client.t("%d seconds")),
+	}
+	for i, unit := range units {
+		if unit == "" {
+			continue
+		}
+		if i+1 < len(units) && units[i+1] != "" {
+			return unit + ", " + units[i+1]
+		}
+		return unit
+	}
+	return "" // unreachable
+}
+
+func durationUnit(count int, one, many string) string {
+	switch count {
+	case 0:
+		return ""
+	case 1:
+		return one
+	default:
+		return fmt.Sprintf(many, count)
+	}
+}
@@ -0,0 +1,39 @@
+package irc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ergochat/ergo/irc/languages"
+)
+
+func TestFormatDuration(t *testing.T) {
+	server := &Server{}
+	lm, err := languages.NewManager(false, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.config.Store(&Config{
+		languageManager: lm,
+	})
+	client := &Client{server: server}
+
+	assertEqual(client.formatDuration(0), "less than a second")
+	assertEqual(client.formatDuration(time.Second), "1 second")
+	assertEqual(client.formatDuration(90*time.Second), "1 minute, 30 seconds")
+	assertEqual(client.formatDuration(2*time.Hour+5*time.Minute+10*time.Second), "2 hours, 5 minutes")
+	assertEqual(client.formatDuration(24*time.Hour+30*time.Second), "1 day")
+	assertEqual(client.formatDuration(3*24*time.Hour+time.Hour), "3 days, 1 hour")
+}
+
+func TestFormatTime(t *testing.T) {
+	if _, err := loadTimezone("America/New_York"); err != nil {
+		t.Skip("timezone database unavailable")
+	}
+	client := &Client{accountSettings: AccountSettings{Timezone: "America/New_York"}}
+	ts := time.Date(2024, time.January, 2, 15, 4, 5, 0, time.UTC)
+	assertEqual(client.formatTime(ts), "Tue, 02 Jan 2024 10:04:05 EST")
+
+	client = &Client{}
+	assertEqual(client.formatTime(ts), "Tue, 02 Jan 2024 15:04:05 UTC")
+}
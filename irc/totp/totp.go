@@ -0,0 +1,84 @@
+// Package totp implements time-based one-time passwords (RFC 6238), in the
+// variant (HMAC-SHA1, 6 digits, 30-second steps) used by authenticator apps.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	Digits = 6
+	Period = 30 * time.Second
+
+	// accept codes from this many steps before and after the current one,
+	// to allow for clock skew
+	skew = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new random secret, base32-encoded as expected by
+// authenticator apps.
+func GenerateSecret() string {
+	var buf [20]byte
+	rand.Read(buf[:])
+	return encoding.EncodeToString(buf[:])
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	return encoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+}
+
+// generate computes the code for a given step (RFC 4226, section 5.3)
+func generate(key []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0xf
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digits, value%1000000)
+}
+
+// Counter returns the step number for a given time.
+func Counter(t time.Time) uint64 {
+	return uint64(t.Unix()) / uint64(Period/time.Second)
+}
+
+// Validate checks a code against a secret at time `now`. If the code is
+// valid, it returns the step number it was generated for, so that callers
+// can reject reuse of the same code.
+func Validate(secret, code string, now time.Time) (counter uint64, ok bool) {
+	key, err := decodeSecret(secret)
+	if err != nil || len(code) != Digits {
+		return 0, false
+	}
+	current := Counter(now)
+	for i := -skew; i <= skew; i++ {
+		counter = uint64(int64(current) + int64(i))
+		if subtle.ConstantTimeCompare([]byte(generate(key, counter)), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// URI returns an otpauth:// URI for the secret, which authenticator apps can
+// import (typically after it is rendered as a QR code).
+func URI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, params.Encode())
+}
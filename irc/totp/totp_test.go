@@ -0,0 +1,57 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// test vectors from RFC 6238, appendix B (SHA1), truncated to 6 digits
+var rfcSecret = encoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestRFCVectors(t *testing.T) {
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, v := range vectors {
+		now := time.Unix(v.unix, 0)
+		if _, ok := Validate(rfcSecret, v.code, now); !ok {
+			t.Errorf("code %s should be valid at %d", v.code, v.unix)
+		}
+	}
+}
+
+func TestSkew(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	if _, ok := Validate(rfcSecret, "005924", now.Add(Period)); !ok {
+		t.Errorf("code from the previous step should be accepted")
+	}
+	if _, ok := Validate(rfcSecret, "005924", now.Add(3*Period)); ok {
+		t.Errorf("code from several steps ago should be rejected")
+	}
+	if _, ok := Validate(rfcSecret, "005925", now); ok {
+		t.Errorf("wrong code should be rejected")
+	}
+	if _, ok := Validate("not base32!", "005924", now); ok {
+		t.Errorf("invalid secret should be rejected")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret := GenerateSecret()
+	key, err := decodeSecret(secret)
+	if err != nil || len(key) != 20 {
+		t.Errorf("bad secret %s: %v", secret, err)
+	}
+	now := time.Now()
+	code := generate(key, Counter(now))
+	if counter, ok := Validate(secret, code, now); !ok || counter != Counter(now) {
+		t.Errorf("generated code should be valid")
+	}
+}
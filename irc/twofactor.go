@@ -0,0 +1,201 @@
+package irc
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tidwall/buntdb"
+
+	"github.com/ergochat/ergo/irc/totp"
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+const (
+	// TOTP enrollment of an operator block, by oper name
+	keyOperTOTP = "oper.totp %s"
+
+	// number of single-use recovery codes issued on enrollment
+	twoFactorRecoveryCodes = 8
+)
+
+// twoFactorInfo is the stored state of an enrollment in TOTP two-factor
+// authentication, either for an account or for an operator block.
+type twoFactorInfo struct {
+	Secret string
+	// enrollment is pending until the user has proven they can generate codes
+	Confirmed bool
+	// SHA-256 hashes of the unused recovery codes; since the codes are random,
+	// a fast hash is sufficient
+	RecoveryCodes []string
+	// last TOTP step for which a code was accepted, to prevent replays
+	LastCounter uint64
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+func loadTwoFactor(tx *buntdb.Tx, key string) (info twoFactorInfo, found bool) {
+	raw, err := tx.Get(key)
+	if err != nil {
+		return
+	}
+	found = json.Unmarshal([]byte(raw), &info) == nil
+	return
+}
+
+func saveTwoFactor(tx *buntdb.Tx, key string, info twoFactorInfo) error {
+	raw, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	_, _, err = tx.Set(key, string(raw), nil)
+	return err
+}
+
+// validate checks a TOTP code or recovery code against an enrollment,
+// consuming it if it is valid
+func (info *twoFactorInfo) validate(code string) (ok bool) {
+	if counter, valid := totp.Validate(info.Secret, code, time.Now()); valid && info.LastCounter < counter {
+		info.LastCounter = counter
+		return true
+	}
+	hashed := hashRecoveryCode(code)
+	for i, stored := range info.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hashed)) == 1 {
+			info.RecoveryCodes = append(info.RecoveryCodes[:i], info.RecoveryCodes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// TwoFactorEnabled returns whether a code is required for the account or oper block
+// stored under `key`.
+func (server *Server) TwoFactorEnabled(key string) (enabled bool) {
+	server.store.View(func(tx *buntdb.Tx) error {
+		info, found := loadTwoFactor(tx, key)
+		enabled = found && info.Confirmed
+		return nil
+	})
+	return
+}
+
+// CheckTwoFactor validates (and consumes) a TOTP or recovery code. If the
+// key has no confirmed enrollment, it succeeds without checking anything.
+func (server *Server) CheckTwoFactor(key, code string) (err error) {
+	return server.store.Update(func(tx *buntdb.Tx) error {
+		info, found := loadTwoFactor(tx, key)
+		if !found || !info.Confirmed {
+			return nil
+		}
+		if !info.validate(code) {
+			return errInvalidTwoFactorCode
+		}
+		return saveTwoFactor(tx, key, info)
+	})
+}
+
+// BeginTwoFactor starts (or restarts) a pending enrollment, returning the new secret.
+func (server *Server) BeginTwoFactor(key string) (secret string, err error) {
+	err = server.store.Update(func(tx *buntdb.Tx) error {
+		if info, found := loadTwoFactor(tx, key); found && info.Confirmed {
+			return errTwoFactorAlreadyEnabled
+		}
+		secret = totp.GenerateSecret()
+		return saveTwoFactor(tx, key, twoFactorInfo{Secret: secret})
+	})
+	return
+}
+
+// ConfirmTwoFactor completes a pending enrollment, given a valid code from the
+// user's authenticator, and returns the recovery codes (which are not stored).
+func (server *Server) ConfirmTwoFactor(key, code string) (recoveryCodes []string, err error) {
+	err = server.store.Update(func(tx *buntdb.Tx) error {
+		info, found := loadTwoFactor(tx, key)
+		if !found {
+			return errTwoFactorNotEnabled
+		} else if info.Confirmed {
+			return errTwoFactorAlreadyEnabled
+		}
+		if !info.validate(code) {
+			return errInvalidTwoFactorCode
+		}
+		info.Confirmed = true
+		for i := 0; i < twoFactorRecoveryCodes; i++ {
+			recoveryCode := utils.GenerateSecretToken()[:10]
+			recoveryCodes = append(recoveryCodes, recoveryCode)
+			info.RecoveryCodes = append(info.RecoveryCodes, hashRecoveryCode(recoveryCode))
+		}
+		return saveTwoFactor(tx, key, info)
+	})
+	return
+}
+
+// DisableTwoFactor removes an enrollment; unless `force` is set, this
+// requires a valid code.
+func (server *Server) DisableTwoFactor(key, code string, force bool) (err error) {
+	return server.store.Update(func(tx *buntdb.Tx) error {
+		info, found := loadTwoFactor(tx, key)
+		if !found {
+			return errTwoFactorNotEnabled
+		}
+		if info.Confirmed && !force && !info.validate(code) {
+			return errInvalidTwoFactorCode
+		}
+		_, err := tx.Delete(key)
+		return err
+	})
+}
+
+// twoFactorCommand implements the enrollment subcommands shared by NS TOTP and
+// OPERTOTP: ENABLE, VERIFY <code>, and DISABLE <code>
+func twoFactorCommand(client *Client, key, label string, params []string, notice func(string)) {
+	server := client.server
+	subcommand := ""
+	if len(params) > 0 {
+		subcommand = strings.ToLower(params[0])
+	}
+	var code string
+	if len(params) > 1 {
+		code = params[1]
+	}
+
+	switch subcommand {
+	case "enable":
+		secret, err := server.BeginTwoFactor(key)
+		if err != nil {
+			notice(client.t(err.Error()))
+			return
+		}
+		notice(fmt.Sprintf(client.t("Your two-factor secret is: %s"), secret))
+		notice(fmt.Sprintf(client.t("Add it to your authenticator app, or import this URI: %s"), totp.URI(server.Config().Network.Name, label, secret)))
+		notice(client.t("Then confirm your enrollment by sending a code from the app with the VERIFY subcommand"))
+	case "verify":
+		recoveryCodes, err := server.ConfirmTwoFactor(key, code)
+		if err != nil {
+			notice(client.t(err.Error()))
+			return
+		}
+		notice(client.t("Two-factor authentication is now enabled"))
+		notice(client.t("These are your recovery codes; each can be used once in place of a code from your app. Store them somewhere safe:"))
+		notice(strings.Join(recoveryCodes, " "))
+		server.logger.Info("accounts", "client", client.Nick(), "enabled two-factor authentication for", label)
+	case "disable":
+		err := server.DisableTwoFactor(key, code, false)
+		if err != nil {
+			notice(client.t(err.Error()))
+			return
+		}
+		notice(client.t("Two-factor authentication is now disabled"))
+		server.logger.Info("accounts", "client", client.Nick(), "disabled two-factor authentication for", label)
+	default:
+		notice(client.t("Invalid parameters"))
+	}
+}
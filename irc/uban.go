@@ -159,6 +159,10 @@ func ubanAddHandler(client *Client, target ubanTarget, params []string, rb *Resp
 
 	operReason := strings.Join(params, " ")
 
+	if !client.server.checkOperActionLimit(client, "UBAN", rb) {
+		return false
+	}
+
 	switch target.banType {
 	case ubanCIDR:
 		err = ubanAddCIDR(client, target, duration, requireSASL, operReason, rb)
@@ -228,7 +232,9 @@ func ubanAddCIDR(client *Client, target ubanTarget, duration time.Duration, requ
 	}
 
 	sessions, nicks := sessionsForCIDR(client.server, target.cidr, rb.session, requireSASL)
+	nickDelay := client.server.Config().Server.NickDelay
 	for _, session := range sessions {
+		client.server.clients.DelayNick(session.client, nickDelay)
 		session.client.Quit("You have been banned from this server", session)
 		session.client.destroy(session)
 	}
@@ -254,10 +260,12 @@ func ubanAddNickmask(client *Client, target ubanTarget, duration time.Duration,
 
 	var killed []string
 	var alwaysOn []string
+	nickDelay := client.server.Config().Server.NickDelay
 	for _, mcl := range client.server.clients.AllClients() {
 		if mcl != client && target.matcher.MatchString(mcl.NickMaskCasefolded()) {
 			if !mcl.AlwaysOn() {
 				killed = append(killed, mcl.Nick())
+				client.server.clients.DelayNick(mcl, nickDelay)
 				mcl.Quit("You have been banned from this server", nil)
 				mcl.destroy(nil)
 			} else {
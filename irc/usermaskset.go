@@ -7,6 +7,7 @@ package irc
 
 import (
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -107,6 +108,28 @@ func (set *UserMaskSet) Masks() (result map[string]MaskInfo) {
 	return
 }
 
+// SortedMasks returns the masks in the order they were added (oldest first).
+func (set *UserMaskSet) SortedMasks() (masks []string, infos []MaskInfo) {
+	set.RLock()
+	masks = make([]string, 0, len(set.masks))
+	for mask := range set.masks {
+		masks = append(masks, mask)
+	}
+	sort.Slice(masks, func(i, j int) bool {
+		ti, tj := set.masks[masks[i]].TimeCreated, set.masks[masks[j]].TimeCreated
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return masks[i] < masks[j]
+	})
+	infos = make([]MaskInfo, len(masks))
+	for i, mask := range masks {
+		infos[i] = set.masks[mask]
+	}
+	set.RUnlock()
+	return
+}
+
 // Match matches the given n!u@h against the standard (non-ext) bans.
 func (set *UserMaskSet) Match(userhost string) bool {
 	regexp := set.regexp.Load()
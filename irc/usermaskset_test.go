@@ -4,7 +4,9 @@
 package irc
 
 import (
+	"slices"
 	"testing"
+	"time"
 )
 
 func TestUserMaskSet(t *testing.T) {
@@ -34,3 +36,22 @@ func TestUserMaskSet(t *testing.T) {
 		t.Errorf("unexpected MatchMute() succeeded")
 	}
 }
+
+func TestUserMaskSetSortedMasks(t *testing.T) {
+	s := NewUserMaskSet()
+	now := time.Now().UTC()
+	s.SetMasks(map[string]MaskInfo{
+		"c!*@*": {TimeCreated: now.Add(-time.Hour)},
+		"a!*@*": {TimeCreated: now},
+		"b!*@*": {TimeCreated: now},
+		"d!*@*": {TimeCreated: now.Add(-2 * time.Hour)},
+	})
+	masks, infos := s.SortedMasks()
+	expected := []string{"d!*@*", "c!*@*", "a!*@*", "b!*@*"}
+	if !slices.Equal(masks, expected) {
+		t.Errorf("incorrect mask order: %v", masks)
+	}
+	if len(infos) != len(masks) || !infos[0].TimeCreated.Equal(now.Add(-2*time.Hour)) {
+		t.Errorf("mask infos do not correspond to masks: %v", infos)
+	}
+}
@@ -53,6 +53,12 @@ func SecretTokensMatch(storedToken string, suppliedToken string) bool {
 	return subtle.ConstantTimeCompare([]byte(storedToken), []byte(suppliedToken)) == 1
 }
 
+// check a supplied certfp against a configured one, in constant time;
+// as with SecretTokensMatch, an empty configured certfp matches nothing
+func CertfpsMatch(storedCertfp string, suppliedCertfp string) bool {
+	return SecretTokensMatch(storedCertfp, suppliedCertfp)
+}
+
 // generate a 256-bit secret key that can be written into a config file
 func GenerateSecretKey() string {
 	var buf [32]byte
@@ -5,9 +5,11 @@
 package utils
 
 import (
+	"context"
 	"net"
 	"regexp"
 	"strings"
+	"time"
 )
 
 var (
@@ -197,17 +199,20 @@ func HandleXForwardedFor(remoteAddr string, xForwardedFor string, whitelist []ne
 // LookupHostname does an (optionally reverse-confirmed) hostname lookup
 // suitable for use as an IRC hostname. It falls back to a string
 // representation of the IP address (again suitable for use as an IRC
-// hostname).
-func LookupHostname(ip net.IP, forwardConfirm bool) (hostname string, lookupSuccessful bool) {
+// hostname). The lookups together may take at most `timeout`.
+func LookupHostname(ip net.IP, forwardConfirm bool, timeout time.Duration) (hostname string, lookupSuccessful bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
 	ipString := ip.String()
 	var candidate string
-	names, err := net.LookupAddr(ipString)
+	names, err := net.DefaultResolver.LookupAddr(ctx, ipString)
 	if err == nil && 0 < len(names) {
 		candidate = strings.TrimSuffix(names[0], ".")
 	}
 	if IsHostname(candidate) {
 		if forwardConfirm {
-			addrs, err := net.LookupHost(candidate)
+			addrs, err := net.DefaultResolver.LookupHost(ctx, candidate)
 			if err == nil {
 				for _, addr := range addrs {
 					if forwardIP := net.ParseIP(addr); ip.Equal(forwardIP) {
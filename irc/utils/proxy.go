@@ -48,10 +48,24 @@ type ListenerConfig struct {
 	RequireProxy  bool
 	// these are just metadata for easier tracking,
 	// they are not used by ReloadableListener:
-	Tor       bool
-	STSOnly   bool
-	WebSocket bool
-	HideSTS   bool
+	Tor         bool
+	STSOnly     bool
+	WebSocket   bool
+	HideSTS     bool
+	RequireSASL bool
+	Keepalive   KeepaliveOverrides
+	// suppress LUSERS and MOTD in the registration burst:
+	Quiet bool
+	// path of an alternate MOTD file for this listener:
+	MOTD string
+}
+
+// KeepaliveOverrides are per-listener overrides of the server's keepalive
+// settings; zero values mean that the server-wide setting applies.
+type KeepaliveOverrides struct {
+	RegistrationTimeout time.Duration `yaml:"registration-timeout"`
+	PingInterval        time.Duration `yaml:"ping-interval"`
+	PingTimeout         time.Duration `yaml:"ping-timeout"`
 }
 
 // read a PROXY header (either v1 or v2), ensuring we don't read anything beyond
@@ -208,15 +222,35 @@ func parseProxyLineV2(line []byte) (ip net.IP, err error) {
 // configuration.
 type WrappedConn struct {
 	net.Conn
-	ProxiedIP net.IP
-	TLS       bool
-	Tor       bool
-	STSOnly   bool
-	WebSocket bool
-	HideSTS   bool
+	ProxiedIP   net.IP
+	TLS         bool
+	Tor         bool
+	STSOnly     bool
+	WebSocket   bool
+	HideSTS     bool
+	RequireSASL bool
+	Keepalive   KeepaliveOverrides
+	Quiet       bool
+	MOTD        string
 	// Secure indicates whether we believe the connection between us and the client
 	// was secure against interception and modification (including all proxies):
 	Secure bool
+
+	listener *ReloadableListener
+	closed   atomic.Bool
+}
+
+func (conn *WrappedConn) Close() error {
+	if conn.closed.CompareAndSwap(false, true) {
+		conn.listener.active.Add(-1)
+	}
+	return conn.Conn.Close()
+}
+
+// ListenerStats reports the connections accepted by a listener.
+type ListenerStats struct {
+	Active   int64
+	Accepted uint64
 }
 
 // ReloadableListener is a wrapper for net.Listener that allows reloading
@@ -225,6 +259,9 @@ type ReloadableListener struct {
 	realListener net.Listener
 	// nil means the listener is closed:
 	config atomic.Pointer[ListenerConfig]
+
+	active   atomic.Int64
+	accepted atomic.Uint64
 }
 
 func NewReloadableListener(realListener net.Listener, config ListenerConfig) *ReloadableListener {
@@ -275,18 +312,32 @@ func (rl *ReloadableListener) Accept() (conn net.Conn, err error) {
 		conn = tls.Server(conn, config.TLSConfig)
 	}
 
+	rl.active.Add(1)
+	rl.accepted.Add(1)
 	return &WrappedConn{
-		Conn:      conn,
-		ProxiedIP: proxiedIP,
-		TLS:       config.TLSConfig != nil,
-		Tor:       config.Tor,
-		STSOnly:   config.STSOnly,
-		WebSocket: config.WebSocket,
-		HideSTS:   config.HideSTS,
+		Conn:        conn,
+		ProxiedIP:   proxiedIP,
+		TLS:         config.TLSConfig != nil,
+		Tor:         config.Tor,
+		STSOnly:     config.STSOnly,
+		WebSocket:   config.WebSocket,
+		HideSTS:     config.HideSTS,
+		RequireSASL: config.RequireSASL,
+		Keepalive:   config.Keepalive,
+		Quiet:       config.Quiet,
+		MOTD:        config.MOTD,
 		// Secure will be set later by client code
+		listener: rl,
 	}, nil
 }
 
+func (rl *ReloadableListener) Stats() ListenerStats {
+	return ListenerStats{
+		Active:   rl.active.Load(),
+		Accepted: rl.accepted.Load(),
+	}
+}
+
 func (rl *ReloadableListener) Close() error {
 	rl.config.Store(nil)
 
@@ -14,6 +14,31 @@ func IsRestrictedCTCPMessage(message string) bool {
 	return strings.HasPrefix(message, "\x01") && !strings.HasPrefix(message, "\x01ACTION")
 }
 
+// ParseDCCSend checks whether a message is a CTCP DCC SEND offer,
+// returning the offered filename if it is.
+func ParseDCCSend(message string) (filename string, ok bool) {
+	if !strings.HasPrefix(message, "\x01") {
+		return
+	}
+	body := strings.TrimSuffix(message[1:], "\x01")
+	command, rest, _ := strings.Cut(body, " ")
+	if !strings.EqualFold(command, "DCC") {
+		return
+	}
+	dccType, rest, _ := strings.Cut(rest, " ")
+	if !strings.EqualFold(dccType, "SEND") {
+		return
+	}
+	// the filename may be quoted if it contains spaces
+	if strings.HasPrefix(rest, "\"") {
+		if end := strings.IndexByte(rest[1:], '"'); end != -1 {
+			return rest[1 : end+1], true
+		}
+	}
+	filename, _, _ = strings.Cut(rest, " ")
+	return filename, true
+}
+
 type MessagePair struct {
 	Message string
 	Concat  bool // should be relayed with the multiline-concat tag
@@ -79,6 +104,19 @@ func (sm *SplitMessage) ValidMultiline() bool {
 	return false
 }
 
+// IsActionMessage returns whether the message (or any line of it) is a CTCP ACTION.
+func (sm *SplitMessage) IsActionMessage() bool {
+	if strings.HasPrefix(sm.Message, "\x01ACTION") {
+		return true
+	}
+	for i := 0; i < len(sm.Split); i++ {
+		if strings.HasPrefix(sm.Split[i].Message, "\x01ACTION") {
+			return true
+		}
+	}
+	return false
+}
+
 func (sm *SplitMessage) IsRestrictedCTCPMessage() bool {
 	if IsRestrictedCTCPMessage(sm.Message) {
 		return true
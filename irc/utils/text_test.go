@@ -66,3 +66,37 @@ func BenchmarkTokenLines(b *testing.B) {
 		tl.Lines()
 	}
 }
+
+func TestParseDCCSend(t *testing.T) {
+	cases := []struct {
+		message  string
+		filename string
+		ok       bool
+	}{
+		{"\x01DCC SEND setup.exe 2130706433 5000 1024\x01", "setup.exe", true},
+		{"\x01dcc send \"my photo.jpg\" 2130706433 5000\x01", "my photo.jpg", true},
+		{"\x01DCC CHAT chat 2130706433 5000\x01", "", false},
+		{"\x01ACTION sends a file\x01", "", false},
+		{"DCC SEND setup.exe 2130706433 5000", "", false},
+	}
+	for _, c := range cases {
+		filename, ok := ParseDCCSend(c.message)
+		if filename != c.filename || ok != c.ok {
+			t.Errorf("ParseDCCSend(%q): expected (%q, %v), got (%q, %v)", c.message, c.filename, c.ok, filename, ok)
+		}
+	}
+}
+
+func TestIsActionMessage(t *testing.T) {
+	action, version, plain := MakeMessage("\x01ACTION waves\x01"), MakeMessage("\x01VERSION\x01"), MakeMessage("ACTION")
+	if !action.IsActionMessage() {
+		t.Error("ACTION should be detected")
+	}
+	if version.IsActionMessage() || plain.IsActionMessage() {
+		t.Error("only CTCP ACTION should be detected")
+	}
+	multiline := SplitMessage{Split: []MessagePair{{Message: "hi"}, {Message: "\x01ACTION waves\x01"}}}
+	if !multiline.IsActionMessage() {
+		t.Error("ACTION in a multiline batch should be detected")
+	}
+}
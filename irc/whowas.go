@@ -6,11 +6,18 @@ package irc
 
 import (
 	"sync"
+	"time"
 )
 
+// WhoWasEntry is a WhoWas record, together with the time it was recorded.
+type WhoWasEntry struct {
+	WhoWas
+	time time.Time
+}
+
 // WhoWasList holds our list of prior clients (for use with the WHOWAS command).
 type WhoWasList struct {
-	buffer []WhoWas
+	buffer []WhoWasEntry
 	// three possible states:
 	// empty: start == end == -1
 	// partially full: start != end
@@ -18,17 +25,27 @@ type WhoWasList struct {
 	// if entries exist, they go from `start` to `(end - 1) % length`
 	start int
 	end   int
+	// entries older than this are not returned (0 for no limit)
+	maxAge time.Duration
 
 	accessMutex sync.RWMutex // tier 1
 }
 
 // NewWhoWasList returns a new WhoWasList
 func (list *WhoWasList) Initialize(size int) {
-	list.buffer = make([]WhoWas, size)
+	list.buffer = make([]WhoWasEntry, size)
 	list.start = -1
 	list.end = -1
 }
 
+// SetMaxAge sets the age after which entries are no longer returned by Find.
+func (list *WhoWasList) SetMaxAge(maxAge time.Duration) {
+	list.accessMutex.Lock()
+	defer list.accessMutex.Unlock()
+
+	list.maxAge = maxAge
+}
+
 // Append adds an entry to the WhoWasList.
 func (list *WhoWasList) Append(whowas WhoWas) {
 	list.accessMutex.Lock()
@@ -52,11 +69,11 @@ func (list *WhoWasList) Append(whowas WhoWas) {
 		list.start = list.end // advance start as well, overwriting first entry
 	}
 
-	list.buffer[pos] = whowas
+	list.buffer[pos] = WhoWasEntry{WhoWas: whowas, time: time.Now().UTC()}
 }
 
 // Find tries to find an entry in our WhoWasList with the given details.
-func (list *WhoWasList) Find(nickname string, limit int) (results []WhoWas) {
+func (list *WhoWasList) Find(nickname string, limit int) (results []WhoWasEntry) {
 	casefoldedNickname, err := CasefoldName(nickname)
 	if err != nil {
 		return
@@ -68,9 +85,17 @@ func (list *WhoWasList) Find(nickname string, limit int) (results []WhoWas) {
 	if list.start == -1 {
 		return
 	}
+	var cutoff time.Time
+	if list.maxAge != 0 {
+		cutoff = time.Now().UTC().Add(-list.maxAge)
+	}
 	// iterate backwards through the ring buffer
 	pos := list.prev(list.end)
 	for limit == 0 || len(results) < limit {
+		// entries are in chronological order, so everything from here on is too old
+		if list.buffer[pos].time.Before(cutoff) {
+			break
+		}
 		if casefoldedNickname == list.buffer[pos].nickCasefolded {
 			results = append(results, list.buffer[pos])
 		}
@@ -5,6 +5,7 @@ package irc
 
 import (
 	"testing"
+	"time"
 )
 
 func makeTestWhowas(nick string) WhoWas {
@@ -22,7 +23,7 @@ func makeTestWhowas(nick string) WhoWas {
 }
 
 func TestWhoWas(t *testing.T) {
-	var results []WhoWas
+	var results []WhoWasEntry
 	var wwl WhoWasList
 	wwl.Initialize(3)
 	// test Find on empty list
@@ -101,3 +102,27 @@ func TestEmptyWhoWas(t *testing.T) {
 		t.Fatalf("incorrect whowas results: %v", results)
 	}
 }
+
+func TestWhoWasMaxAge(t *testing.T) {
+	var wwl WhoWasList
+	wwl.Initialize(3)
+	wwl.SetMaxAge(time.Hour)
+
+	wwl.Append(makeTestWhowas("dan-"))
+	wwl.Append(makeTestWhowas("slingamn"))
+	results := wwl.Find("dan-", 0)
+	if len(results) != 1 || results[0].nick != "dan-" {
+		t.Fatalf("incorrect whowas results: %v", results)
+	}
+
+	// backdate the first entry past the maximum age
+	wwl.buffer[0].time = time.Now().UTC().Add(-2 * time.Hour)
+	results = wwl.Find("dan-", 0)
+	if len(results) != 0 {
+		t.Fatalf("incorrect whowas results: %v", results)
+	}
+	results = wwl.Find("slingamn", 0)
+	if len(results) != 1 || results[0].nick != "slingamn" {
+		t.Fatalf("incorrect whowas results: %v", results)
+	}
+}
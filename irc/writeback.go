@@ -0,0 +1,54 @@
+package irc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ergochat/ergo/irc/sno"
+)
+
+const (
+	// retry intervals for failed write-backs of channel and always-on client state
+	writebackMinRetry = time.Second
+	writebackMaxRetry = time.Minute
+)
+
+// writebackStatus tracks the failures of a channel's or always-on client's
+// write-backs across write loops and blocking Store calls. It is protected
+// by the owner's writebackLock.
+type writebackStatus struct {
+	failures int
+	// a write loop is waiting to retry a failed write; wakeWriter leaves
+	// any new dirty bits to it instead of starting another loop
+	retrying bool
+}
+
+// writebackResult processes the outcome of a write-back (see Channel.writeLoop
+// and Client.writeLoop), and must be called while holding the writebackLock
+// that protects status. Instead of retrying a failing write in a tight loop,
+// the write loop waits for the returned delay; opers are notified when writes
+// for the target start failing and when they recover.
+func (server *Server) writebackResult(target string, status *writebackStatus, err error) (delay time.Duration) {
+	if err == nil {
+		if status.failures != 0 {
+			server.logger.Info("internal", "write-back recovered for", target, "after failures:", fmt.Sprintf("%d", status.failures))
+			server.snomasks.Send(sno.LocalAnnouncements, fmt.Sprintf("Database writes for %s succeeded after %d failure(s)", target, status.failures))
+			status.failures = 0
+		}
+		return 0
+	}
+
+	status.failures++
+	server.logger.Error("internal", "write-back failed for", target, err.Error())
+	if status.failures == 1 {
+		server.snomasks.Send(sno.LocalAnnouncements, fmt.Sprintf("Database writes for %s are failing, will retry: %s", target, err.Error()))
+	}
+	delay = writebackMinRetry
+	for i := 1; i < status.failures && delay < writebackMaxRetry; i++ {
+		delay *= 2
+	}
+	if delay > writebackMaxRetry {
+		delay = writebackMaxRetry
+	}
+	return
+}
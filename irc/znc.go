@@ -159,7 +159,7 @@ func zncPlaybackPlayHandler(client *Client, command string, params []string, rb
 	} else {
 		targets = make(utils.HashSet[string])
 		for _, targetName := range strings.Split(targetString, ",") {
-			if strings.HasPrefix(targetName, "#") {
+			if isChannelName(targetName) {
 				if cfTarget, err := CasefoldChannel(targetName); err == nil {
 					targets.Add(cfTarget)
 				}
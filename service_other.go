@@ -0,0 +1,24 @@
+//go:build !windows
+
+package main
+
+import (
+	"log"
+	"os"
+	"syscall"
+
+	"github.com/ergochat/ergo/irc"
+)
+
+// runServer runs the server in the foreground; it exits on receipt of one
+// of utils.ServerExitSignals, or restarts itself after an oper RESTART.
+func runServer(server *irc.Server) {
+	server.Run()
+	if server.RestartRequested() {
+		executable, err := os.Executable()
+		if err == nil {
+			err = syscall.Exec(executable, os.Args, os.Environ())
+		}
+		log.Fatal("Could not restart: ", err)
+	}
+}
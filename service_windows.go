@@ -0,0 +1,62 @@
+//go:build windows
+
+package main
+
+import (
+	"log"
+
+	"golang.org/x/sys/windows/svc"
+
+	"github.com/ergochat/ergo/irc"
+)
+
+// serviceHandler lets the Windows service control manager start and stop
+// the server, in lieu of the POSIX signals used on other platforms.
+type serviceHandler struct {
+	server *irc.Server
+}
+
+func (h *serviceHandler) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (svcSpecificEC bool, exitCode uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.server.Run()
+	}()
+
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				status <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				h.server.Stop()
+				<-done
+				return false, 0
+			}
+		case <-done:
+			return false, 0
+		}
+	}
+}
+
+// runServer runs the server in the foreground, or under the service control
+// manager if we were started as a Windows service.
+func runServer(server *irc.Server) {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		log.Fatal("Could not determine whether running as a Windows service: ", err.Error())
+	}
+	if !isService {
+		server.Run()
+		return
+	}
+	if err := svc.Run("ergo", &serviceHandler{server: server}); err != nil {
+		log.Fatal("Windows service failed: ", err.Error())
+	}
+}